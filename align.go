@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// --align buffers lines until it has alignWindow of them, or for at most
+// alignDelay, and aligns the columns of each batch.
+const (
+	alignWindow = 50
+	alignDelay  = 100 * time.Millisecond
+)
+
+// alignedOutput is the output of a record, held back by --align, and the
+// end of the record, which separates its rows along with newlines.
+type alignedOutput struct {
+	text, end string
+}
+
+// rows splits the output into lines, each with its terminator: the record's
+// end, as with -0 or --delimiter, or a newline within a record that spans
+// several lines.
+func (a alignedOutput) rows() []string {
+	records := []string{a.text}
+	if a.end != "" && a.end != "\n" {
+		records = strings.SplitAfter(a.text, a.end)
+	}
+	var rows []string
+	for _, record := range records {
+		for _, row := range strings.SplitAfter(record, "\n") {
+			if row != "" {
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows
+}
+
+// alignFields splits a highlighted row into its leading indentation and the
+// fields separated by runs of spaces and tabs. Escape sequences stay with the
+// text they color, and those between fields go with the next one.
+func alignFields(row string) (indent string, fields []string) {
+	var field, pending strings.Builder
+	visible := false // the current field has text, not only escapes
+	state := -1
+	for rest := row; rest != ""; {
+		var token string
+		var w int
+		token, w, state = ansiToken(rest, state)
+		rest = rest[len(token):]
+		switch {
+		case token == " " || token == "\t":
+			if visible {
+				fields = append(fields, field.String())
+				field.Reset()
+				visible = false
+			} else if len(fields) == 0 {
+				indent += pending.String() + token
+				pending.Reset()
+			}
+		case w == 0 && !visible:
+			pending.WriteString(token)
+		default:
+			if !visible {
+				field.WriteString(pending.String())
+				pending.Reset()
+			}
+			field.WriteString(token)
+			visible = true
+		}
+	}
+	if visible || pending.Len() > 0 {
+		field.WriteString(pending.String())
+		fields = append(fields, field.String())
+	}
+	return indent, fields
+}
+
+// flushAligned writes the lines buffered by --align with their fields padded
+// into columns, as column -t does. The last field of a line isn't padded, so
+// a long message at the end doesn't widen its column for the others.
+func (o *options) flushAligned() {
+	if len(o.aligned) == 0 {
+		return
+	}
+	type row struct {
+		indent string
+		fields []string
+		end    string
+	}
+	var rows []row
+	var widths []int
+	for _, output := range o.aligned {
+		for _, line := range output.rows() {
+			text := strings.TrimSuffix(line, "\n")
+			if output.end != "" && strings.HasSuffix(line, output.end) {
+				text = strings.TrimSuffix(line, output.end)
+			}
+			text = strings.TrimRight(text, "\r")
+			r := row{end: line[len(text):]}
+			r.indent, r.fields = alignFields(text)
+			for i, f := range r.fields[:max(len(r.fields)-1, 0)] {
+				if i == len(widths) {
+					widths = append(widths, 0)
+				}
+				widths[i] = max(widths[i], displayWidth(f))
+			}
+			rows = append(rows, r)
+		}
+	}
+	var b strings.Builder
+	for _, r := range rows {
+		b.WriteString(r.indent)
+		for i, f := range r.fields {
+			if i < len(r.fields)-1 {
+				b.WriteString(padRight(f, widths[i]) + " ")
+			} else {
+				b.WriteString(f)
+			}
+		}
+		b.WriteString(r.end)
+	}
+	fmt.Print(b.String())
+	o.aligned = o.aligned[:0]
+}
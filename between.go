@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// betweenSep joins the two markers of a --between flag into its one value.
+const betweenSep = "\x00"
+
+// joinBetween rewrites each --between START END in args to a single argument,
+// --between=START<NUL>END, since flags take only one value. Arguments after
+// -- are left alone.
+func joinBetween(args []string) []string {
+	var joined []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(joined, args[i:]...)
+		}
+		if (arg == "-between" || arg == "--between") && i+2 < len(args) {
+			joined = append(joined, arg+"="+args[i+1]+betweenSep+args[i+2])
+			i += 2
+			continue
+		}
+		joined = append(joined, arg)
+	}
+	return joined
+}
+
+// betweenList collects the --between markers.
+type betweenList []struct{ start, end string }
+
+func (l *betweenList) String() string { return "" }
+
+func (l *betweenList) Set(value string) error {
+	start, end, found := strings.Cut(value, betweenSep)
+	if !found {
+		return fmt.Errorf("want a START and an END marker")
+	}
+	*l = append(*l, struct{ start, end string }{start, end})
+	return nil
+}
+
+// region is a --between region: the lines from one matching start to the
+// next matching end, both included, tinted in the region's color.
+type region struct {
+	start, end wordConfig
+	color      string
+}
+
+// parseRegions resolves the --between markers. Markers are patterns, matched
+// like rules; the end marker can carry the region's color, and regions
+// without one take the palette colors in turn.
+func (o *options) parseRegions() ([]region, error) {
+	var regions []region
+	used := make(map[int]bool)
+	for _, b := range o.between {
+		end, colorStr, _ := strings.Cut(normalizeRule(b.end, o.sep), ruleSep)
+		configs, err := parseArgs([]string{normalizeRule(b.start, o.sep), end}, o.parseOptions())
+		if err != nil {
+			return nil, err
+		}
+		r := region{start: configs[0], end: configs[1]}
+		if colorStr != "" {
+			if r.color, err = parseColor(colorStr, o.background); err != nil {
+				return nil, fmt.Errorf("invalid --between color '%s': %v", colorStr, err)
+			}
+			reserveColor(r.color, used, o.background)
+		}
+		regions = append(regions, r)
+	}
+	for i := range regions {
+		if regions[i].color == "" {
+			regions[i].color = getNextAvailableColor(used, o.background)
+		}
+	}
+	return regions, nil
+}
+
+// regionColor returns the --between color of text, a record of source, or ""
+// outside regions. Each source keeps its own stack of open regions, so
+// regions nest and overlap: the innermost open region colors the line, and a
+// start matched inside its own region opens it again, to be closed by its own
+// end. The start and end lines belong to the region, even when they're the
+// same line.
+func (o *options) regionColor(source, text string) string {
+	if o.openRegions == nil {
+		o.openRegions = make(map[string][]int)
+	}
+	open := o.openRegions[source]
+	color := ""
+	if len(open) > 0 {
+		color = o.regions[open[len(open)-1]].color
+	}
+	for i, r := range o.regions {
+		innermost := -1
+		for j, k := range open {
+			if k == i {
+				innermost = j
+			}
+		}
+		if innermost >= 0 && len(findMatches(text, r.end)) > 0 {
+			open = slices.Delete(open, innermost, innermost+1)
+			continue
+		}
+		starts := findMatches(text, r.start)
+		if len(starts) == 0 {
+			continue
+		}
+		color = r.color
+		// A region that ends on its start line colors only that line
+		if len(findMatches(text[starts[0].end:], r.end)) == 0 {
+			open = append(open, i)
+		}
+	}
+	o.openRegions[source] = open
+	return color
+}
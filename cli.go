@@ -0,0 +1,880 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sharunkumar/ch/version"
+	"golang.org/x/text/encoding"
+)
+
+// errUsage reports a command-line mistake whose usage text has already been
+// printed.
+var errUsage = errors.New("usage")
+
+// options holds the flags shared by all commands.
+type options struct {
+	caseSensitive    bool
+	smartCase        bool
+	wholeWord        bool
+	strictWord       bool
+	wordChars        string
+	fixedStrings     bool
+	background       bool
+	invalidUTF8      string
+	encoding         string
+	keepCRLF         bool
+	nullData         bool
+	delimiter        string
+	showAll          bool
+	rawEscapes       bool
+	expandTabs       int
+	follow           bool
+	noFilename       bool
+	lineNumbers      bool
+	byteOffset       bool
+	label            string
+	icons            iconsFlag
+	prettyJSONIndent prettyJSONFlag
+	syntax           string
+	between          betweenList
+	hide             stringList
+	replace          stringList
+	drop             stringList
+	dropFields       stringList
+	redact           stringList
+	redactSecrets    bool
+	redactMode       string
+	template         string
+	cut              string
+	align            bool
+	fields           string
+	extract          stringList
+	unique           bool
+	count            bool
+	allOf            bool
+	rainbowBrackets  bool
+	indentGuides     bool
+	ts               tsFlag
+	elapsedSince     elapsedFlag
+	lineNumberColor  string
+	recursive        stringList
+	include          stringList
+	exclude          stringList
+	noIgnore         bool
+	binary           bool
+	listen           string
+	journal          journalFlag
+	priority         string
+	eventLog         string
+	ssh              stringList
+	sshCommand       string
+	mergeByTime      bool
+	tint             bool
+	replay           bool
+	speed            speedFlag
+	record           string
+	tail             int
+	truncate         widthFlag
+	wrap             widthFlag
+	focus            bool
+	invert           bool
+	onlyMatching     bool
+	maxCount         int
+	head             int
+	palette          string
+	theme            string
+	explain          bool
+	testLines        stringList
+	showVersion      bool
+	profiles         stringList
+	exprs            stringList
+	sep              string
+	patternFiles     stringList
+	noRC             bool
+
+	// self-update flags
+	updateCheck bool
+	updateForce bool
+
+	// profile flags
+	profileName  string
+	profileForce bool
+
+	// kube flags
+	kubeSelector  string
+	kubeNamespace string
+	kubeContainer string
+	kubeContext   string
+
+	// diff flags
+	ignoreTimestamps bool
+
+	// split flags
+	splitLeft  stringList
+	splitRight stringList
+
+	// convert flags
+	convertTo string
+
+	// Resolved by setup
+	cfg            *config
+	themeSource    string
+	paletteSource  string
+	fileRules      []string
+	profileRules   []string
+	rcFile         string
+	inputEncoding  encoding.Encoding
+	delimiterRe    *regexp.Regexp
+	files          []string
+	readFiles      bool // files or -R were given, even if all were filtered out
+	containers     []string
+	pods           []string
+	sources        []string // the files, containers, pods or hosts read
+	sourceColors   map[string]sourceColor
+	nameWidth      int
+	numberColor    string // color of line numbers, from --line-number-color
+	labelPrefix    string // the --label, colored
+	syntaxColors   syntaxColors
+	syntaxLanguage func(line string, colors syntaxColors) []span // from --syntax
+	started        time.Time
+	lastRead       time.Time // when the previous record was read, for --elapsed=previous
+	nesting        map[string]*nesting
+	regions        []region           // from --between
+	hidePatterns   []wordConfig       // from --hide
+	substitutions  []substitution     // from --replace
+	redactPatterns []wordConfig       // from --redact and --redact-secrets
+	redactKey      []byte             // keys the hashes of --redact-mode hash
+	extractor      *extractor         // from --extract
+	tmpl           *template.Template // from --template
+	fieldsRe       *regexp.Regexp     // from --fields
+	cutSpec        *cutSpec           // from --cut
+	aligned        []alignedOutput    // output waiting for --align
+	openRegions    map[string][]int   // indexes of the open regions of each source, innermost last
+
+	// flagged holds the matching options as given on the command line,
+	// before profiles and the .chrc file turn more of them on
+	flagged struct{ caseSensitive, wholeWord, background bool }
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// flagSet defines the shared flags on a new FlagSet for the named command.
+func (o *options) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("ch "+name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&o.caseSensitive, "s", false, "case-sensitive matching (default: case-insensitive)")
+	fs.BoolVar(&o.allOf, "all-of", false, "only highlight lines that match every rule given on the command line, so -R, -o and -m select lines by all of them")
+	fs.BoolVar(&o.smartCase, "S", false, "smart case: match case-sensitively only patterns with uppercase letters")
+	fs.BoolVar(&o.wholeWord, "w", false, "extend matches over the surrounding word: letters, digits, marks, _ and the --word-chars")
+	fs.BoolVar(&o.strictWord, "W", false, "only highlight matches that are whole words, like grep -w")
+	fs.StringVar(&o.wordChars, "word-chars", "", "count `CHARS` as word characters for -w and -W, besides letters, digits and _")
+	fs.BoolVar(&o.fixedStrings, "F", false, "treat every pattern as a literal string, even /regex/ ones")
+	fs.BoolVar(&o.background, "b", false, "use background colors instead of foreground")
+	fs.StringVar(&o.palette, "palette", "", "auto-assignment palette `NAME`: default, deuteranopia, protanopia, tritanopia or one from the config file")
+	fs.StringVar(&o.theme, "theme", "", "color theme `NAME`: auto (default), dark, light or a file in ~/.config/ch/themes")
+	fs.Var(&o.exprs, "e", "add the rule `PATTERN[::color]`, even if it starts with - (repeatable)")
+	fs.StringVar(&o.sep, "sep", ruleSep, "separate patterns from colors with `SEP` in command-line rules")
+	fs.Var(&o.patternFiles, "p", "add the rules in `FILE`, one per line (repeatable)")
+	fs.Var(&o.profiles, "profile", "add the rules of profile `NAME` from ~/.config/ch/presets or the built-ins (repeatable)")
+	fs.BoolVar(&o.noRC, "no-chrc", false, "don't apply rules from a .chrc file in this or a parent directory")
+	fs.StringVar(&o.encoding, "encoding", "utf-8", "transcode input from `NAME` to UTF-8, e.g. latin1, utf16le, windows-1252 or shift_jis")
+	fs.BoolVar(&o.nullData, "0", false, "read and write NUL-terminated records instead of lines, as with find -print0")
+	fs.StringVar(&o.delimiter, "delimiter", "", "split records on `DELIM`, a string or /regex/, instead of newlines")
+	fs.BoolVar(&o.keepCRLF, "keep-crlf", false, "end output lines with CRLF where the input did (default: LF)")
+	fs.StringVar(&o.invalidUTF8, "invalid-utf8", "raw", "handle invalid UTF-8 input `MODE`: raw (pass through), replace (with U+FFFD) or escape (as \\xNN)")
+	fs.StringVar(&o.template, "template", "", "reshape JSON and logfmt lines with the Go `TEMPLATE`, as in '{{.ts}} {{.level}} {{.msg}}', before highlighting")
+	fs.StringVar(&o.fields, "fields", "", "with --template or --cut, take the fields of each line from the named groups of `/REGEX/`")
+	fs.StringVar(&o.cut, "cut", "", "keep only the whitespace-separated columns in `LIST`, as in 1,3,5-7, or the named JSON, logfmt or --fields fields, as in ts,msg, before highlighting")
+	fs.BoolVar(&o.align, "align", false, "pad the whitespace-separated fields of nearby lines into aligned columns, keeping their highlights")
+	fs.Var(&o.extract, "extract", "print only the capture groups of `PATTERN`, or its matches, one per line, colored (repeatable)")
+	fs.BoolVar(&o.unique, "unique", false, "with --extract, print each value only the first time it is found")
+	fs.BoolVar(&o.count, "count", false, "with --extract, print how often each value was found at the end, most frequent first")
+	fs.BoolVar(&o.onlyMatching, "o", false, "print only the highlighted parts of each line, one per line")
+	fs.BoolVar(&o.focus, "focus", false, "dim everything except the highlights")
+	fs.BoolVar(&o.invert, "invert", false, "dim the matches instead of coloring them, to mute noisy tokens")
+	fs.Var(&o.truncate, "truncate", "cut lines to the terminal width, or `N` columns, ending in …")
+	fs.Var(&o.wrap, "wrap", "wrap long lines at the terminal width, or `N` columns, keeping their colors")
+	fs.BoolVar(&o.showAll, "A", false, "show tabs, trailing spaces, carriage returns and control characters as symbols")
+	fs.BoolVar(&o.rawEscapes, "raw-escapes", false, "pass escape sequences in the input through (default: keep colors, remove the rest)")
+	fs.IntVar(&o.expandTabs, "expand-tabs", 0, "expand tabs to spaces with tab stops every `N` columns before matching")
+	fs.BoolVar(&o.follow, "f", false, "keep reading the files given after -- as they grow, like tail -F")
+	fs.IntVar(&o.tail, "tail", 0, "start at the last `N` lines of the input (default with -f: 10)")
+	fs.Var(&o.recursive, "R", "search the files under `DIR`, printing only lines with highlights, like grep -r (repeatable)")
+	fs.Var(&o.include, "include", "only read files whose name matches `GLOB`, e.g. '*.log' (repeatable)")
+	fs.Var(&o.exclude, "exclude", "skip files and directories whose name matches `GLOB` (repeatable)")
+	fs.BoolVar(&o.noIgnore, "no-ignore", false, "with -R, also read .git and files ignored by .gitignore")
+	fs.BoolVar(&o.binary, "binary", false, "read files containing NUL bytes as text instead of skipping them")
+	fs.StringVar(&o.listen, "listen", "", "receive syslog messages on `ADDR`, udp://HOST:PORT or tcp://HOST:PORT, instead of reading stdin")
+	fs.Var(&o.journal, "journal", "follow the systemd journal, or only `UNIT`'s entries, instead of reading stdin (Linux)")
+	fs.StringVar(&o.priority, "priority", "", "with --journal, only show entries of `PRIORITY` or more severe, e.g. warning or err..crit")
+	fs.StringVar(&o.eventLog, "eventlog", "", "stream new events from the Windows Event Log `CHANNEL`, e.g. Application or System (Windows)")
+	fs.Var(&o.ssh, "ssh", "run the --cmd command on each of `HOSTS`, comma-separated, and read its output instead of stdin (repeatable)")
+	fs.StringVar(&o.sshCommand, "cmd", "", "with --ssh, the `COMMAND` to run on each host, e.g. 'tail -F /var/log/app.log'")
+	fs.BoolVar(&o.mergeByTime, "merge-by-time", false, "interleave lines from several sources in the order of their timestamps")
+	fs.BoolVar(&o.replay, "replay", false, "print lines paced by their timestamps, to watch a log back as it was written")
+	fs.Var(&o.speed, "speed", "with --replay, play back `N` times faster, e.g. 4x (default 1x)")
+	fs.StringVar(&o.record, "record", "", "save the input with its timing to the session `FILE`, to replay later")
+	fs.Var(&o.hide, "hide", "drop lines matching `PATTERN` from the output, like grep -v (repeatable)")
+	fs.Var(&o.replace, "replace", "rewrite matches of PATTERN to TEXT, with $1 for regex groups, before highlighting, given as `PATTERN=>TEXT[::color]` (repeatable)")
+	fs.Var(&o.redact, "redact", "mask matches of `PATTERN`, such as tokens or passwords, before display (repeatable)")
+	fs.BoolVar(&o.redactSecrets, "redact-secrets", false, "mask common secrets: API keys and tokens, JWTs, passwords in key=value pairs and URLs, and email addresses")
+	fs.StringVar(&o.redactMode, "redact-mode", "block", "mask secrets `MODE`: block (█████) or hash, the same for the same secret within a run")
+	fs.Var(&o.drop, "drop", "replace matches of `PATTERN`, such as base64 payloads, with a short placeholder giving their size (repeatable)")
+	fs.Var(&o.dropFields, "drop-field", "replace the value of the JSON or logfmt field `NAME` with a short placeholder giving its size (repeatable)")
+	fs.Var(&o.between, "between", "color the region `START END[::color]`: the lines from one matching START through the next matching END (repeatable)")
+	fs.BoolVar(&o.tint, "tint", false, "tint the text of each source's lines in its own muted color")
+	fs.BoolVar(&o.lineNumbers, "n", false, "prefix each line with its line number in its input")
+	fs.Var(&o.prettyJSONIndent, "pretty-json", "reformat and color JSON in lines, indented by `N` spaces across lines if given")
+	fs.StringVar(&o.syntax, "syntax", "", "color the text as `LANG`: yaml, xml, sql statements within lines, code in diffs and compiler errors, or a language like go, under the highlights")
+	fs.BoolVar(&o.rainbowBrackets, "rainbow-brackets", false, "color bracket pairs by their depth, across lines, and closing brackets that close nothing in red")
+	fs.BoolVar(&o.indentGuides, "indent-guides", false, "draw faint guides in indentation at the columns of the enclosing lines")
+	fs.Var(&o.icons, "icons", "show ❌, ⚠️ or ✅ before highlighted error, warning and success words, or instead of them with --icons=replace")
+	fs.StringVar(&o.label, "label", "", "prefix each line with `NAME[::color]`, in its own color unless given, to tell several ch apart in one terminal")
+	fs.Var(&o.ts, "ts", "prefix each line with the time it was read, in the strftime `FORMAT` if given (default '%b %d %H:%M:%S')")
+	fs.Var(&o.elapsedSince, "elapsed", "prefix each line with the time since ch started, or since the line before with --elapsed=previous")
+	fs.BoolVar(&o.byteOffset, "byte-offset", false, "prefix each line with the byte offset it starts at in its input")
+	fs.StringVar(&o.lineNumberColor, "line-number-color", "", "color line numbers and byte offsets in `COLOR` (default: grey)")
+	fs.BoolVar(&o.noFilename, "no-filename", false, "don't prefix lines with their file name when reading several files or with -R")
+	fs.IntVar(&o.maxCount, "m", 0, "stop after `N` lines with highlights")
+	fs.IntVar(&o.head, "head", 0, "stop after `N` lines")
+	fs.BoolVar(&o.explain, "explain", false, "trace which rules matched or were discarded to stderr")
+	fs.Var(&o.testLines, "test", "highlight `LINE` instead of reading stdin (repeatable)")
+	fs.BoolVar(&o.showVersion, "version", false, "print version and build information")
+	return fs
+}
+
+// setup loads the config file and applies the theme and palette.
+func (o *options) setup() error {
+	o.started = time.Now()
+	if o.sep == "" {
+		return fmt.Errorf("--sep must not be empty")
+	}
+	if !slices.Contains(invalidUTF8Modes, o.invalidUTF8) {
+		return fmt.Errorf("unknown --invalid-utf8 mode '%s' (use %s)", o.invalidUTF8, strings.Join(invalidUTF8Modes, ", "))
+	}
+	enc, err := lookupEncoding(o.encoding)
+	if err != nil {
+		return err
+	}
+	o.inputEncoding = enc
+	if o.expandTabs < 0 {
+		return fmt.Errorf("--expand-tabs must not be negative")
+	}
+	if o.focus && o.invert {
+		return fmt.Errorf("--focus and --invert can't be used together")
+	}
+	if o.truncate.set && o.wrap.set {
+		return fmt.Errorf("--truncate and --wrap can't be used together")
+	}
+	if o.nullData && o.delimiter != "" {
+		return fmt.Errorf("-0 and --delimiter can't be used together")
+	}
+	if o.delimiterRe, err = parseDelimiter(o.delimiter); err != nil {
+		return err
+	}
+	for _, glob := range append(o.include, o.exclude...) {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob '%s': %v", glob, err)
+		}
+	}
+	if o.listen != "" {
+		if _, _, err := parseListen(o.listen); err != nil {
+			return err
+		}
+	}
+	if o.speed != 0 && !o.replay {
+		return fmt.Errorf("--speed needs --replay")
+	}
+	if o.tail < 0 {
+		return fmt.Errorf("--tail must not be negative")
+	}
+	if o.follow && len(o.recordSep()) != 1 {
+		return fmt.Errorf("-f can't find the last lines of the input with this --delimiter or --encoding")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("reading config: %v", err)
+	}
+	o.cfg = cfg
+
+	o.themeSource = "flag"
+	if o.theme == "" {
+		o.theme, o.themeSource = cfg.Theme, "config"
+	}
+	if o.theme == "" || o.theme == "auto" {
+		o.theme, o.themeSource = detectTheme(), "detected"
+	}
+	// Even dark is loaded, since a user themes/dark.yaml overrides it
+	t, err := loadTheme(o.theme)
+	if err != nil {
+		return err
+	}
+	if err := t.apply(); err != nil {
+		return err
+	}
+
+	o.flagged.caseSensitive, o.flagged.wholeWord, o.flagged.background = o.caseSensitive, o.wholeWord, o.background
+	if err := o.loadRules(); err != nil {
+		return err
+	}
+	if err := o.loadPalette(); err != nil {
+		return err
+	}
+	o.numberColor = dimColor
+	if o.lineNumberColor != "" {
+		color, err := parseColor(o.lineNumberColor, false)
+		if err != nil {
+			return fmt.Errorf("invalid --line-number-color '%s': %v", o.lineNumberColor, err)
+		}
+		o.numberColor = color
+	}
+	if o.hidePatterns, err = o.parseHide(); err != nil {
+		return err
+	}
+	if o.substitutions, err = o.parseReplace(); err != nil {
+		return err
+	}
+	if !slices.Contains(redactModes, o.redactMode) {
+		return fmt.Errorf("invalid --redact-mode '%s' (use %s)", o.redactMode, strings.Join(redactModes, " or "))
+	}
+	if o.redactPatterns, err = o.parseRedact(); err != nil {
+		return err
+	}
+	if o.extractor, err = o.parseExtract(); err != nil {
+		return err
+	}
+	if err := o.parseTemplate(); err != nil {
+		return err
+	}
+	if o.cutSpec, err = parseCut(o.cut); err != nil {
+		return err
+	}
+	if (o.unique || o.count) && o.extractor == nil {
+		return fmt.Errorf("--unique and --count need --extract")
+	}
+	if o.regions, err = o.parseRegions(); err != nil {
+		return err
+	}
+	o.syntaxColors = loadSyntaxColors()
+	o.syntaxLanguage = nil
+	if o.syntax != "" {
+		if o.syntaxLanguage, err = lookupSyntax(o.syntax); err != nil {
+			return err
+		}
+	}
+	o.labelPrefix = ""
+	if o.label != "" {
+		name, colorStr, _ := strings.Cut(o.label, ruleSep)
+		color := sourceColors([]string{name})[name].prefix
+		if colorStr != "" {
+			if color, err = parseColor(colorStr, false); err != nil {
+				return fmt.Errorf("invalid --label color '%s': %v", colorStr, err)
+			}
+		}
+		o.labelPrefix = color + "[" + name + "]" + Reset + " "
+	}
+	return nil
+}
+
+// loadRules reads the pattern files, the selected profiles and the .chrc
+// file, merging their rules and options with those given on the command line.
+func (o *options) loadRules() error {
+	o.fileRules = nil
+	for _, path := range o.patternFiles {
+		rules, err := readPatternFile(path)
+		if err != nil {
+			return err
+		}
+		o.fileRules = append(o.fileRules, rules...)
+	}
+
+	var profiles []*profile
+	for _, name := range o.profiles {
+		p, err := loadProfile(name)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+	if !o.noRC {
+		if cwd, err := os.Getwd(); err == nil {
+			o.rcFile = findRCFile(cwd)
+		}
+		if o.rcFile != "" {
+			p, err := readProfile(o.rcFile)
+			if err != nil {
+				return err
+			}
+			profiles = append(profiles, p)
+		}
+	}
+
+	o.profileRules = nil
+	o.caseSensitive, o.wholeWord, o.background = o.flagged.caseSensitive, o.flagged.wholeWord, o.flagged.background
+	for _, p := range profiles {
+		o.profileRules = append(o.profileRules, p.Rules...)
+		o.caseSensitive = o.caseSensitive || p.CaseSensitive
+		o.wholeWord = o.wholeWord || p.WholeWord
+		o.background = o.background || p.Background
+	}
+	return nil
+}
+
+// loadPalette selects the auto-assignment palette from the flag or the config
+// file.
+func (o *options) loadPalette() error {
+	if o.paletteSource != "" && o.paletteSource != "flag" {
+		o.palette = "" // resolve again from the config file
+	}
+	p, err := selectPalette(o.palette, o.cfg)
+	if err != nil {
+		return err
+	}
+	palette = p
+	o.paletteSource = "flag"
+	switch {
+	case o.palette != "":
+	case o.cfg.Palette != "":
+		o.palette, o.paletteSource = o.cfg.Palette, "config"
+	default:
+		o.palette, o.paletteSource = "default", "default"
+	}
+	return nil
+}
+
+// ruleFiles lists the files rules and options are read from: the config
+// file, the pattern files, the selected user profiles and the .chrc file.
+// User profiles that don't exist yet are included, as creating one overrides
+// the built-in.
+func (o *options) ruleFiles() []string {
+	files := append([]string{configPath()}, o.patternFiles...)
+	if dir := presetsDir(); dir != "" {
+		for _, name := range o.profiles {
+			files = append(files, filepath.Join(dir, name+".yaml"))
+		}
+	}
+	if o.rcFile != "" {
+		files = append(files, o.rcFile)
+	}
+	return files
+}
+
+// reload reads the config file, profiles and .chrc file again so a
+// long-running ch picks up edits. The theme is kept as it was.
+func (o *options) reload() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("reading config: %v", err)
+	}
+	o.cfg = cfg
+	if err := o.loadRules(); err != nil {
+		return err
+	}
+	return o.loadPalette()
+}
+
+// parseOptions returns the options for parsing the rules.
+func (o *options) parseOptions() parseOptions {
+	return parseOptions{
+		caseSensitive: o.caseSensitive,
+		background:    o.background,
+		fixedStrings:  o.fixedStrings,
+		smartCase:     o.smartCase,
+	}
+}
+
+// rules returns the highlight rules from the command line, -e rules first,
+// followed by those of the pattern files, the selected profiles and the .chrc
+// file, so explicit rules win overlapping matches. Command-line rules are
+// rewritten from the --sep separator to the standard one.
+func (o *options) rules(args []string) []string {
+	var rules []string
+	for _, rule := range append(append([]string{}, o.exprs...), args...) {
+		rules = append(rules, normalizeRule(rule, o.sep))
+	}
+	rules = append(rules, o.fileRules...)
+	return append(rules, o.profileRules...)
+}
+
+// command is a ch subcommand.
+type command struct {
+	name    string
+	args    string // argument synopsis for usage
+	summary string
+	run     func(opts *options, fs *flag.FlagSet, args []string) error
+	// flags, if set, defines the command's own flags; its help then lists
+	// only those instead of the shared highlighting options
+	flags func(fs *flag.FlagSet, opts *options)
+	// highlights commands take the shared options besides their own flags
+	highlights bool
+	// standalone commands skip loading the config, theme and palette
+	standalone bool
+}
+
+// commands lists the subcommands; the first is the default when the first
+// argument isn't a command name. It is populated in init because help refers
+// back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "run", args: "[options] <pattern>[::color] ... [-- file ...]", summary: "highlight patterns in stdin or files (default command)", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			args, opts.files = splitFiles(args)
+			rules := opts.rules(args)
+			// --hide, --replace, --drop, --redact, --extract, --template and
+			// --cut alone filter and rewrite without highlighting
+			if len(rules) == 0 && len(opts.hide) == 0 && len(opts.substitutions) == 0 && len(opts.redactPatterns) == 0 && opts.extractor == nil && opts.tmpl == nil && opts.cutSpec == nil {
+				printHelp(os.Stderr, nil, fs)
+				return errUsage
+			}
+			if err := opts.resolveInputs(); err != nil {
+				return err
+			}
+			return runHighlight(opts, args)
+		}},
+		{name: "docker", args: "[options] [<pattern>[::color] ...] -- <container> ...", summary: "highlight patterns in the logs of Docker containers", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			args, opts.containers = splitFiles(args)
+			if len(opts.containers) == 0 {
+				return fmt.Errorf("give the containers to follow after --, as in ch docker error -- web db")
+			}
+			if err := opts.resolveInputs(); err != nil {
+				return err
+			}
+			return runHighlight(opts, args)
+		}},
+		{name: "kube", args: "-l <selector> [options] [<pattern>[::color] ...]", summary: "highlight patterns in the logs of Kubernetes pods", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			if opts.kubeSelector == "" {
+				printHelp(os.Stderr, findCommand("kube"), fs)
+				return errUsage
+			}
+			pods, err := opts.listPods()
+			if err != nil {
+				return err
+			}
+			opts.pods = pods
+			if err := opts.resolveInputs(); err != nil {
+				return err
+			}
+			return runHighlight(opts, args)
+		}, flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.kubeSelector, "l", "", "follow the pods matching the label `SELECTOR`, e.g. app=web")
+			fs.StringVar(&opts.kubeNamespace, "namespace", "", "look for pods in `NAMESPACE` (default: the context's)")
+			fs.StringVar(&opts.kubeContainer, "container", "", "only show the logs of container `NAME` (default: all)")
+			fs.StringVar(&opts.kubeContext, "context", "", "use the kubeconfig context `NAME`")
+		}, highlights: true},
+		{name: "diff", args: "[options] <file1> <file2> [<pattern>[::color] ...]", summary: "compare two files, highlighting patterns in the changed lines", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			if len(args) < 2 {
+				printHelp(os.Stderr, findCommand("diff"), fs)
+				return errUsage
+			}
+			m, err := opts.newMatcher(args[2:], nil)
+			if err != nil {
+				return err
+			}
+			return runDiff(os.Stdout, opts, m, args[0], args[1])
+		}, flags: func(fs *flag.FlagSet, opts *options) {
+			fs.BoolVar(&opts.ignoreTimestamps, "ignore-timestamps", false, "compare lines as if their timestamps were equal, to line up two runs of a job")
+		}, highlights: true},
+		{name: "split", args: "[options] <file1> <file2> [<pattern>[::color] ...]", summary: "show two files side by side, each with its own rules", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			if len(args) < 2 {
+				printHelp(os.Stderr, findCommand("split"), fs)
+				return errUsage
+			}
+			matchers, err := opts.splitMatchers(args[2:])
+			if err != nil {
+				return err
+			}
+			return runSplit(os.Stdout, opts, [2]string{args[0], args[1]}, matchers)
+		}, flags: func(fs *flag.FlagSet, opts *options) {
+			fs.Var(&opts.splitLeft, "left", "add the rule `PATTERN[::color]` to the left pane only (repeatable)")
+			fs.Var(&opts.splitRight, "right", "add the rule `PATTERN[::color]` to the right pane only (repeatable)")
+		}, highlights: true},
+		{name: "convert", args: "--to asciicast|html [options] <session> [<pattern>[::color] ...]", summary: "convert a recorded session to an asciinema cast or an HTML page", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			if len(args) == 0 || opts.convertTo == "" {
+				printHelp(os.Stderr, findCommand("convert"), fs)
+				return errUsage
+			}
+			if !slices.Contains(convertFormats, opts.convertTo) {
+				return fmt.Errorf("unknown format '%s' for --to (use %s)", opts.convertTo, strings.Join(convertFormats, " or "))
+			}
+			opts.files = args[:1]
+			if err := opts.resolveInputs(); err != nil {
+				return err
+			}
+			m, err := opts.newMatcher(args[1:], nil)
+			if err != nil {
+				return err
+			}
+			return runConvert(os.Stdout, opts, m, args[0], opts.convertTo)
+		}, flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.convertTo, "to", "", "write the session as `FORMAT`: asciicast or html")
+		}, highlights: true},
+		{name: "colors", args: "[options]", summary: "show available colors as swatches", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			runColors(os.Stdout, opts.palette)
+			return nil
+		}},
+		{name: "preview", args: "[options] <pattern>[::color] ...", summary: "show rules in their colors and the resolved settings", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			configs, err := parseArgs(opts.rules(args), opts.parseOptions())
+			if err != nil {
+				return err
+			}
+			configFile := configPath()
+			if _, err := os.Stat(configFile); err != nil {
+				configFile += " (not found)"
+			}
+			runPreview(os.Stdout, configs, []setting{
+				{"config file", configFile, ""},
+				{envOptsVar, fmt.Sprintf("%q", os.Getenv(envOptsVar)), "environment"},
+				{"theme", opts.theme, opts.themeSource},
+				{"palette", opts.palette, opts.paletteSource},
+				{"pattern files", opts.patternFiles.String(), "flag -p"},
+				{"profiles", opts.profiles.String(), "flag --profile"},
+				{"rc file", opts.rcFile, rcFileName},
+				{"case-sensitive", fmt.Sprint(opts.caseSensitive), "flag -s"},
+				{"smart case", fmt.Sprint(opts.smartCase), "flag -S"},
+				{"whole word", fmt.Sprint(opts.wholeWord), "flag -w"},
+				{"strict whole word", fmt.Sprint(opts.strictWord), "flag -W"},
+				{"word chars", fmt.Sprintf("%q", opts.wordChars), "flag --word-chars"},
+				{"fixed strings", fmt.Sprint(opts.fixedStrings), "flag -F"},
+				{"background", fmt.Sprint(opts.background), "flag -b"},
+			})
+			return nil
+		}},
+		{name: "completion", args: "bash|zsh|fish|powershell", summary: "print a shell completion script", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			if len(args) != 1 {
+				printHelp(os.Stderr, findCommand("completion"), fs)
+				return errUsage
+			}
+			return runCompletion(os.Stdout, args[0], fs, opts.cfg)
+		}},
+		{name: "profile", args: "list | export <name> | import <file|URL>", summary: "list, export or import highlighting profiles", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			err := runProfile(os.Stdout, args, opts.profileName, opts.profileForce)
+			if errors.Is(err, errUsage) {
+				printHelp(os.Stderr, findCommand("profile"), fs)
+			}
+			return err
+		}, flags: func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.profileName, "name", "", "save an imported profile as `NAME` (default: from the file name)")
+			fs.BoolVar(&opts.profileForce, "force", false, "replace an existing profile on import")
+		}},
+		{name: "doctor", args: "", summary: "report terminal color support and render a test pattern", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			runDoctor(os.Stdout)
+			return nil
+		}, standalone: true},
+		{name: "self-update", args: "[options]", summary: "update ch to the latest GitHub release", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			return runSelfUpdate(os.Stdout, opts.updateCheck, opts.updateForce)
+		}, flags: func(fs *flag.FlagSet, opts *options) {
+			fs.BoolVar(&opts.updateCheck, "check", false, "only report whether an update is available")
+			fs.BoolVar(&opts.updateForce, "force", false, "reinstall even if already up to date")
+		}, standalone: true},
+		{name: "help", args: "[command]", summary: "show help for ch or a command", run: func(opts *options, fs *flag.FlagSet, args []string) error {
+			var cmd *command
+			if len(args) > 0 {
+				if cmd = findCommand(args[0]); cmd == nil {
+					return fmt.Errorf("unknown command '%s'", args[0])
+				}
+			}
+			printHelp(os.Stdout, cmd, fs)
+			return nil
+		}, standalone: true},
+	}
+}
+
+// commandNames lists the subcommands recognized as the first argument.
+func commandNames() []string {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// findCommand returns the named command, or nil.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// execute runs ch with the given command-line arguments. Without a command
+// name, the arguments are highlight rules for the default run command.
+func execute(args []string) error {
+	cmd := &commands[0]
+	if len(args) > 0 {
+		if c := findCommand(args[0]); c != nil {
+			cmd, args = c, args[1:]
+		}
+	}
+
+	opts := &options{}
+	fs := opts.flagSet(cmd.name)
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+
+	// Default options from the environment are parsed first so the command
+	// line can override them. They're parsed on their own, since a rule
+	// among them would end the flags and turn the real ones into rules.
+	if !cmd.standalone {
+		envArgs, err := envOptions()
+		if err != nil {
+			return err
+		}
+		if err := fs.Parse(joinBetween(envArgs)); err != nil {
+			return fmt.Errorf("%s: %v", envOptsVar, err)
+		}
+		if fs.NArg() > 0 {
+			return fmt.Errorf("%s: unexpected argument '%s' (only flags are allowed)", envOptsVar, fs.Arg(0))
+		}
+		args = joinBetween(args)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printHelp(os.Stdout, cmd, fs)
+			return nil
+		}
+		return fmt.Errorf("%v (see 'ch help')", err)
+	}
+	if opts.showVersion {
+		fmt.Println(version.Get())
+		return nil
+	}
+
+	if !cmd.standalone {
+		if err := opts.setup(); err != nil {
+			return err
+		}
+	}
+	return cmd.run(opts, fs, fs.Args())
+}
+
+// flagGroups arranges the flags into sections of the help text.
+var flagGroups = []struct {
+	title string
+	names []string
+}{
+	{"Matching", []string{"s", "S", "w", "W", "word-chars", "F", "all-of", "e", "sep", "p", "profile", "no-chrc"}},
+	{"Input", []string{"0", "delimiter", "encoding", "keep-crlf", "invalid-utf8", "raw-escapes", "expand-tabs", "tail", "f", "R", "include", "exclude", "no-ignore", "binary", "listen", "journal", "priority", "eventlog", "ssh", "cmd", "merge-by-time", "replay", "speed", "record"}},
+	{"Output", []string{"label", "ts", "elapsed", "n", "byte-offset", "line-number-color", "no-filename", "hide", "replace", "drop", "drop-field", "redact", "redact-secrets", "redact-mode", "tint", "between", "template", "fields", "cut", "align", "o", "extract", "unique", "count", "m", "head", "focus", "invert", "icons", "pretty-json", "syntax", "rainbow-brackets", "indent-guides", "truncate", "wrap", "A"}},
+	{"Color", []string{"b", "palette", "theme"}},
+	{"Debugging", []string{"explain", "test", "version"}},
+}
+
+// printFlag writes one flag and its usage in help format.
+func printFlag(w io.Writer, f *flag.Flag) {
+	argName, usage := flag.UnquoteUsage(f)
+	name := "-" + f.Name
+	if len(f.Name) > 1 {
+		name = "-" + name
+	}
+	optional := false
+	if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+		optional = bf.IsBoolFlag()
+	}
+	switch {
+	case argName == "" || argName == "value":
+	case optional:
+		// Flags like --truncate[=N] take an argument only after =
+		name += "[=" + argName + "]"
+	default:
+		name += " " + argName
+	}
+	fmt.Fprintf(w, "  %-18s %s\n", name, usage)
+}
+
+// printOptions writes the flags of fs grouped by flagGroups. Flags missing
+// from the groups are listed under "Other options", except those in own,
+// a command's own flags that were already listed.
+func printOptions(w io.Writer, fs, own *flag.FlagSet) {
+	grouped := make(map[string]bool)
+	for _, g := range flagGroups {
+		fmt.Fprintf(w, "\n%s options:\n", g.title)
+		for _, name := range g.names {
+			if f := fs.Lookup(name); f != nil {
+				printFlag(w, f)
+				grouped[name] = true
+			}
+		}
+	}
+
+	var other []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if !grouped[f.Name] && (own == nil || own.Lookup(f.Name) == nil) {
+			other = append(other, f)
+		}
+	})
+	if len(other) > 0 {
+		fmt.Fprintf(w, "\nOther options:\n")
+		for _, f := range other {
+			printFlag(w, f)
+		}
+	}
+}
+
+// helpReference documents the pattern and color syntax.
+const helpReference = `
+Patterns:
+  word                    literal text
+  /regex/                 regular expression
+  /regex/$1               color only capture group 1 (or $name)
+  /regex/::a=red,b=blue   color named groups a and b
+
+Colors:
+  Named      red, green, orange, blue, pink, purple, or any CSS color name (teal, gold, ...)
+  Hex        any 3- or 6-digit hex color (e.g., FF5500, f50)
+  Functions  rgb(255,80,0), hsl(20,100%,50%)
+  Effects    rainbow, rainbow-chars, <from>..<to> gradient (e.g., red..0000FF)
+
+Example:
+  tail -f app.log | ch error::red warning::orange success::green
+`
+
+// printHelp writes help for cmd, or the overall help when cmd is nil.
+func printHelp(w io.Writer, cmd *command, fs *flag.FlagSet) {
+	if cmd != nil && cmd.name != "run" {
+		fmt.Fprintf(w, "Usage: %s\n\n%s.\n", strings.TrimSpace("ch "+cmd.name+" "+cmd.args), strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+		var own *flag.FlagSet
+		if cmd.flags != nil {
+			own = flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+			cmd.flags(own, &options{})
+			fmt.Fprintf(w, "\nOptions:\n")
+			own.VisitAll(func(f *flag.Flag) { printFlag(w, f) })
+		}
+		if cmd.highlights || cmd.flags == nil && !cmd.standalone && cmd.name != "completion" {
+			printOptions(w, fs, own)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "ch - colored highlighter\n\n")
+	fmt.Fprintf(w, "Usage:\n")
+	fmt.Fprintf(w, "  ch [options] <pattern>[::color] ... [-- file ...]\n")
+	fmt.Fprintf(w, "  ch <command> [options] [args]\n")
+	fmt.Fprintf(w, "\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+	}
+	printOptions(w, fs, nil)
+	fmt.Fprint(w, helpReference)
+}
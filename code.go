@@ -0,0 +1,139 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// lexerSyntax returns the syntax coloring of a language chroma knows, by
+// name, alias or file extension, or nil if it knows none by that name.
+func lexerSyntax(name string) func(string, syntaxColors) []span {
+	lexer := lexers.Get(name)
+	if lexer == nil {
+		return nil
+	}
+	lexer = chroma.Coalesce(lexer)
+	return func(line string, colors syntaxColors) []span {
+		return codeSpans(lexer, line, 0, colors)
+	}
+}
+
+// codeSpans colors code with lexer, for code found at offset in its line.
+// Lines are lexed on their own, so a construct spanning lines, like a block
+// comment, is only recognized on its first line.
+func codeSpans(lexer chroma.Lexer, code string, offset int, colors syntaxColors) []span {
+	tokens, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return nil
+	}
+	var spans []span
+	pos := 0
+	for token := tokens(); token != chroma.EOF; token = tokens() {
+		start := pos
+		pos = min(pos+len(token.Value), len(code))
+		if color := tokenColor(token.Type, colors); color != "" && start < pos {
+			spans = append(spans, span{start: offset + start, end: offset + pos, color: color})
+		}
+	}
+	return spans
+}
+
+// tokenColor maps a chroma token type to a syntax color, or "" to leave it
+// plain.
+func tokenColor(t chroma.TokenType, colors syntaxColors) string {
+	switch {
+	case t == chroma.KeywordConstant:
+		return colors.literal
+	case t == chroma.KeywordType, t == chroma.NameBuiltin, t == chroma.NameClass:
+		return colors.attr
+	case t == chroma.NameTag:
+		return colors.key
+	case t == chroma.NameAttribute:
+		return colors.attr
+	case t == chroma.NameFunction:
+		return colors.literal
+	case t.InCategory(chroma.Keyword):
+		return colors.key
+	case t.InSubCategory(chroma.LiteralString):
+		return colors.str
+	case t.InSubCategory(chroma.LiteralNumber):
+		return colors.number
+	case t.InCategory(chroma.Comment):
+		return colors.comment
+	}
+	return ""
+}
+
+var (
+	// Paths announcing the file of the code that follows: diff headers,
+	// rustc's --> and the file:line: of compilers and linters
+	diffFileHeader = regexp.MustCompile(`^(?:diff --git a/\S+ b/(\S+)|\+\+\+ (?:b/)?(\S+)|Index: (\S+))`)
+	fileLocation   = regexp.MustCompile(`^\s*(?:--> |╭─\[|at |In file included from )?((?:[\w.-]+/)*[\w.-]+\.[A-Za-z]\w*):\d+(?::\d+)?`)
+	// Numbered source lines of compiler errors, as in " 12 |     code"
+	contextLine = regexp.MustCompile(`^\s*\d*\s*[|│] ?`)
+	hunkHeader  = regexp.MustCompile(`^@@ [^@]* @@ ?`)
+)
+
+// codeSyntax colors the code in diffs and compiler errors, in the language
+// of the file named before it: the lines of diff hunks, past their +, - or
+// space, and the numbered source lines of errors. Other lines are left alone.
+type codeSyntax struct {
+	lexer  chroma.Lexer
+	inHunk bool
+	// lexers caches the lexer of each file extension
+	lexers map[string]chroma.Lexer
+}
+
+// newCodeSyntax returns the --syntax code coloring.
+func newCodeSyntax() func(string, syntaxColors) []span {
+	c := &codeSyntax{lexers: make(map[string]chroma.Lexer)}
+	return c.spans
+}
+
+// setFile switches to the language of the file at path.
+func (c *codeSyntax) setFile(path string) {
+	ext := filepath.Ext(path)
+	lexer, ok := c.lexers[ext]
+	if !ok {
+		if lexer = lexers.Match(filepath.Base(path)); lexer != nil {
+			lexer = chroma.Coalesce(lexer)
+		}
+		c.lexers[ext] = lexer
+	}
+	c.lexer = lexer
+}
+
+func (c *codeSyntax) spans(line string, colors syntaxColors) []span {
+	if m := diffFileHeader.FindStringSubmatch(line); m != nil {
+		c.setFile(m[1] + m[2] + m[3])
+		c.inHunk = false
+		return nil
+	}
+	if m := hunkHeader.FindStringIndex(line); m != nil {
+		c.inHunk = true
+		if c.lexer == nil {
+			return nil
+		}
+		// The function the hunk is in follows the header
+		return codeSpans(c.lexer, line[m[1]:], m[1], colors)
+	}
+	if c.inHunk {
+		if line == "" || !strings.ContainsRune(" +-", rune(line[0])) {
+			c.inHunk = false
+		} else if c.lexer != nil {
+			return codeSpans(c.lexer, line[1:], 1, colors)
+		}
+	}
+	if m := fileLocation.FindStringSubmatch(line); m != nil {
+		c.setFile(m[1])
+		return nil
+	}
+	if m := contextLine.FindStringIndex(line); m != nil && c.lexer != nil {
+		return codeSpans(c.lexer, line[m[1]:], m[1], colors)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// ANSI color codes
+const (
+	Reset = "\033[0m"
+)
+
+type namedColor struct {
+	name    string
+	r, g, b int
+}
+
+// Preset colors in order of assignment
+var namedColors = []namedColor{
+	{"red", 255, 105, 97},
+	{"green", 134, 194, 29},
+	{"orange", 240, 160, 75},
+	{"blue", 134, 176, 189},
+	{"pink", 255, 164, 164},
+	{"purple", 203, 166, 247},
+}
+
+// Alternative auto-assignment palettes, selectable with --palette. The
+// colorblind-friendly palettes keep hues apart along the axes each type of
+// color vision deficiency can still distinguish.
+var palettes = map[string][]namedColor{
+	"default": namedColors,
+	// Okabe-Ito palette, led by the blue/orange contrast
+	"deuteranopia": {
+		{"blue", 86, 180, 233},
+		{"orange", 230, 159, 0},
+		{"purple", 204, 121, 167},
+		{"yellow", 240, 228, 66},
+		{"teal", 0, 158, 115},
+		{"darkblue", 0, 114, 178},
+	},
+	// Okabe-Ito palette, avoiding reds that read as dark to protanopes
+	"protanopia": {
+		{"blue", 86, 180, 233},
+		{"yellow", 240, 228, 66},
+		{"purple", 204, 121, 167},
+		{"orange", 230, 159, 0},
+		{"darkblue", 0, 114, 178},
+		{"teal", 0, 158, 115},
+	},
+	// Red/cyan contrasts, avoiding blue/green and yellow/violet pairs
+	"tritanopia": {
+		{"red", 235, 80, 80},
+		{"cyan", 80, 200, 210},
+		{"pink", 255, 140, 200},
+		{"grey", 180, 180, 180},
+		{"darkred", 180, 40, 60},
+		{"teal", 0, 140, 140},
+	},
+}
+
+// palette is the active auto-assignment order.
+var palette = namedColors
+
+// dimColor is the grey of de-emphasized text, such as text outside
+// highlights with --focus. It reads as muted on dark and light backgrounds.
+var dimColor = rgbToANSI(128, 128, 128, false)
+
+// luminance returns the relative luminance of an sRGB color, from 0 to 1.
+func luminance(r, g, b int) float64 {
+	linear := func(c int) float64 {
+		v := float64(c) / 255
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
+
+// contrastThreshold is the background luminance above which black text has
+// more contrast than white text.
+const contrastThreshold = 0.179
+
+func rgbToANSI(r, g, b int, background bool) string {
+	if background {
+		// Pick black or white text so highlights stay readable on any color
+		fg := 255
+		if luminance(r, g, b) > contrastThreshold {
+			fg = 0
+		}
+		return fmt.Sprintf("\033[48;2;%d;%d;%d;38;2;%d;%d;%dm", r, g, b, fg, fg, fg)
+	}
+	return fmt.Sprintf("\033[38;2;%d;%d;%dm", r, g, b)
+}
+
+// hslToRGB converts a hue in degrees and saturation/lightness in [0, 1] to
+// 8-bit RGB components.
+func hslToRGB(h, s, l float64) (int, int, int) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return int(math.Round((r + m) * 255)), int(math.Round((g + m) * 255)), int(math.Round((b + m) * 255))
+}
+
+// parseRGB resolves a color to its RGB components. It accepts names, 3- or
+// 6-digit hex (with or without #), rgb(R,G,B) and hsl(H,S%,L%). Names from the
+// active palette take precedence over the preset named colors, which take
+// precedence over the CSS color names.
+func parseRGB(colorStr string) (r, g, b int, err error) {
+	// Check if it's a named color
+	lowerColor := strings.ToLower(strings.TrimSpace(colorStr))
+	for _, colors := range [][]namedColor{palette, namedColors, cssColors} {
+		for _, nc := range colors {
+			if strings.ToLower(nc.name) == lowerColor {
+				return nc.r, nc.g, nc.b, nil
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(lowerColor, "rgb(") && strings.HasSuffix(lowerColor, ")"):
+		return parseRGBFunc(lowerColor[4 : len(lowerColor)-1])
+	case strings.HasPrefix(lowerColor, "hsl(") && strings.HasSuffix(lowerColor, ")"):
+		return parseHSLFunc(lowerColor[4 : len(lowerColor)-1])
+	}
+
+	// Otherwise treat as hex color
+	hex := strings.TrimPrefix(lowerColor, "#")
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil || (len(hex) != 3 && len(hex) != 6) {
+		if strings.HasPrefix(lowerColor, "#") || err == nil {
+			return 0, 0, 0, fmt.Errorf("hex colors need 3 or 6 hex digits")
+		}
+		return 0, 0, 0, fmt.Errorf("unknown color name")
+	}
+
+	// Expand short hex: f50 -> ff5500
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff), nil
+}
+
+// parseRGBFunc parses the R,G,B arguments of rgb().
+func parseRGBFunc(args string) (r, g, b int, err error) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("rgb() needs 3 components")
+	}
+	var rgb [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			return 0, 0, 0, fmt.Errorf("rgb() components must be integers from 0 to 255")
+		}
+		rgb[i] = v
+	}
+	return rgb[0], rgb[1], rgb[2], nil
+}
+
+// parseHSLFunc parses the H,S%,L% arguments of hsl().
+func parseHSLFunc(args string) (r, g, b int, err error) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("hsl() needs 3 components")
+	}
+	h, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || h < 0 || h > 360 {
+		return 0, 0, 0, fmt.Errorf("hsl() hue must be from 0 to 360")
+	}
+	var sl [2]float64
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(p), "%"), 64)
+		if err != nil || v < 0 || v > 100 {
+			return 0, 0, 0, fmt.Errorf("hsl() saturation and lightness must be percentages from 0 to 100")
+		}
+		sl[i] = v / 100
+	}
+	r, g, b = hslToRGB(h, sl[0], sl[1])
+	return r, g, b, nil
+}
+
+// parseColor resolves a color to its ANSI escape sequence.
+func parseColor(colorStr string, background bool) (string, error) {
+	r, g, b, err := parseRGB(colorStr)
+	if err != nil {
+		return "", err
+	}
+	return rgbToANSI(r, g, b, background), nil
+}
+
+// Rainbow hues use the same soft saturation/lightness as the preset palette.
+const (
+	rainbowSaturation = 0.8
+	rainbowMatchStep  = 40 // hue degrees between successive matches
+)
+
+// rainbowLightness is the lightness of rainbow and generated colors. Themes
+// lower it for light terminal backgrounds.
+var rainbowLightness = 0.7
+
+// colorEffect paints matches with colors that vary per match or per
+// character: the rainbow, rainbow-chars and <from>..<to> gradient colors.
+type colorEffect struct {
+	perChar    bool
+	gradient   bool
+	from, to   [3]int // gradient endpoints
+	matches    int    // matches painted so far, for per-match rainbow cycling
+	background bool
+}
+
+// parseColorEffect parses the rainbow pseudo-colors and <from>..<to> gradients.
+// It returns nil if colorStr is not an effect.
+func parseColorEffect(colorStr string, background bool) *colorEffect {
+	switch strings.ToLower(colorStr) {
+	case "rainbow":
+		return &colorEffect{background: background}
+	case "rainbow-chars":
+		return &colorEffect{perChar: true, background: background}
+	}
+
+	fromStr, toStr, found := strings.Cut(colorStr, "..")
+	if !found {
+		return nil
+	}
+	r1, g1, b1, err1 := parseRGB(fromStr)
+	r2, g2, b2, err2 := parseRGB(toStr)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	return &colorEffect{
+		perChar:    true,
+		gradient:   true,
+		from:       [3]int{r1, g1, b1},
+		to:         [3]int{r2, g2, b2},
+		background: background,
+	}
+}
+
+// colorAt returns the color for step i of n within the effect.
+func (e *colorEffect) colorAt(i, n int) string {
+	if e.gradient {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+		lerp := func(a, b int) int { return a + int(math.Round(float64(b-a)*t)) }
+		return rgbToANSI(lerp(e.from[0], e.to[0]), lerp(e.from[1], e.to[1]), lerp(e.from[2], e.to[2]), e.background)
+	}
+	r, g, b := hslToRGB(360*float64(i)/float64(n), rainbowSaturation, rainbowLightness)
+	return rgbToANSI(r, g, b, e.background)
+}
+
+// paint colors text according to the effect.
+func (e *colorEffect) paint(text string) string {
+	if !e.perChar {
+		r, g, b := hslToRGB(float64(e.matches*rainbowMatchStep), rainbowSaturation, rainbowLightness)
+		e.matches++
+		return rgbToANSI(r, g, b, e.background) + text + Reset
+	}
+
+	// Color whole grapheme clusters, so combining marks and emoji sequences
+	// aren't split by escape codes
+	n := uniseg.GraphemeClusterCount(text)
+	var result strings.Builder
+	state := -1
+	for i := 0; text != ""; i++ {
+		var cluster string
+		cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		result.WriteString(e.colorAt(i, n))
+		result.WriteString(cluster)
+	}
+	result.WriteString(Reset)
+	return result.String()
+}
+
+// goldenAngle is the hue step, in degrees, between generated colors. Stepping
+// by the golden angle keeps successive hues far apart no matter how many are
+// needed, and the sequence is the same on every run.
+const goldenAngle = 137.50776405003785
+
+// generatedColor returns the n-th auto color beyond the preset palette.
+func generatedColor(n int) (int, int, int) {
+	return hslToRGB(20+float64(n)*goldenAngle, rainbowSaturation, rainbowLightness)
+}
+
+func getNextAvailableColor(usedColors map[int]bool, background bool) string {
+	// Find first unused color from the palette
+	for i, nc := range palette {
+		if !usedColors[i] {
+			usedColors[i] = true
+			return rgbToANSI(nc.r, nc.g, nc.b, background)
+		}
+	}
+
+	// If all presets are used, generate additional distinct colors
+	for i := len(palette); ; i++ {
+		if !usedColors[i] {
+			usedColors[i] = true
+			r, g, b := generatedColor(i - len(palette))
+			return rgbToANSI(r, g, b, background)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// completionFlag describes one command-line flag for completion scripts.
+type completionFlag struct {
+	Name      string
+	Usage     string
+	TakesArg  bool
+	ArgValues []string // known values, if any
+}
+
+// completionData is everything the completion scripts offer, generated from
+// the actual flag and color definitions.
+type completionData struct {
+	Commands []string
+	Flags    []completionFlag
+	Colors   []string
+}
+
+// Dash returns the flag as typed: -s for one-letter flags, --palette otherwise.
+func (f completionFlag) Dash() string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// Quoted returns the usage text with single quotes removed for shell scripts.
+func (f completionFlag) Quoted() string {
+	return strings.ReplaceAll(f.Usage, "'", "")
+}
+
+// Words joins values into a space-separated word list.
+func (completionData) Words(values []string) string {
+	return strings.Join(values, " ")
+}
+
+// FlagWords lists every flag as typed on the command line.
+func (d completionData) FlagWords() string {
+	var words []string
+	for _, f := range d.Flags {
+		words = append(words, f.Dash())
+	}
+	return strings.Join(words, " ")
+}
+
+// buildCompletionData collects flags from fs, plus color, palette, theme and
+// profile names from the presets and the user's config.
+func buildCompletionData(fs *flag.FlagSet, cfg *config) completionData {
+	d := completionData{Commands: commandNames()}
+
+	var paletteNames []string
+	for name := range palettes {
+		paletteNames = append(paletteNames, name)
+	}
+	for name := range cfg.Palettes {
+		paletteNames = append(paletteNames, name)
+	}
+	sort.Strings(paletteNames)
+
+	var themeNames []string
+	for name := range themes {
+		themeNames = append(themeNames, name)
+	}
+	themeNames = append([]string{"auto"}, themeNames...)
+	sort.Strings(themeNames[1:])
+
+	seen := make(map[string]bool)
+	for _, colors := range [][]namedColor{palette, namedColors, cssColors} {
+		for _, nc := range colors {
+			if !seen[nc.name] {
+				seen[nc.name] = true
+				d.Colors = append(d.Colors, nc.name)
+			}
+		}
+	}
+
+	argValues := map[string][]string{
+		"palette":      paletteNames,
+		"theme":        themeNames,
+		"profile":      profileNames(),
+		"invalid-utf8": invalidUTF8Modes,
+		"syntax":       syntaxNames(),
+		"redact-mode":  redactModes,
+		// Line numbers take plain colors, not the effects added below
+		"line-number-color": slices.Clone(d.Colors),
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		isBool := false
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			isBool = bf.IsBoolFlag()
+		}
+		_, usage := flag.UnquoteUsage(f)
+		d.Flags = append(d.Flags, completionFlag{
+			Name:      f.Name,
+			Usage:     usage,
+			TakesArg:  !isBool,
+			ArgValues: argValues[f.Name],
+		})
+	})
+
+	d.Colors = append(d.Colors, "rainbow", "rainbow-chars")
+	return d
+}
+
+// completionScripts holds the template for each supported shell.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for ch
+# Load with: source <(ch completion bash)
+_ch() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local token="${line##* }"
+
+    # Colors after word::
+    if [[ "$token" == *::* ]]; then
+        local colors="{{.Words .Colors}}"
+        if [[ "$COMP_WORDBREAKS" == *:* ]]; then
+            COMPREPLY=($(compgen -W "$colors" -- "${token##*::}"))
+        else
+            COMPREPLY=($(compgen -W "$colors" -P "${token%::*}::" -- "${token##*::}"))
+        fi
+        return
+    fi
+
+    case "$prev" in
+{{- range .Flags}}{{if .ArgValues}}
+        {{.Dash}}|-{{.Name}})
+            COMPREPLY=($(compgen -W "{{$.Words .ArgValues}}" -- "$cur"))
+            return
+            ;;
+{{- end}}{{end}}
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "{{.FlagWords}}" -- "$cur"))
+        return
+    fi
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "{{.Words .Commands}}" -- "$cur"))
+    fi
+}
+complete -o default -F _ch ch
+`,
+	"zsh": `#compdef ch
+# zsh completion for ch
+# Load with: source <(ch completion zsh)
+_ch() {
+    # Colors after word::
+    if [[ $PREFIX == *::* ]]; then
+        compset -P '*::'
+        compadd -- {{.Words .Colors}}
+        return
+    fi
+
+    case $words[CURRENT-1] in
+{{- range .Flags}}{{if .ArgValues}}
+        {{.Dash}}|-{{.Name}})
+            compadd -- {{$.Words .ArgValues}}
+            return
+            ;;
+{{- end}}{{end}}
+    esac
+
+    if [[ $PREFIX == -* ]]; then
+        local -a flags
+        flags=(
+{{- range .Flags}}
+            '{{.Dash}}:{{.Quoted}}'
+{{- end}}
+        )
+        _describe 'option' flags
+        return
+    fi
+    if (( CURRENT == 2 )); then
+        compadd -- {{.Words .Commands}}
+    fi
+}
+
+if [ "$funcstack[1]" = "_ch" ]; then
+    _ch "$@"
+else
+    compdef _ch ch
+fi
+`,
+	"fish": `# fish completion for ch
+# Load with: ch completion fish | source
+function __ch_complete_colors
+    set -l token (commandline -ct)
+    if string match -q -- '*::*' $token
+        set -l prefix (string replace -r -- '::[^:]*$' '::' $token)
+        for color in {{.Words .Colors}}
+            echo $prefix$color
+        end
+    end
+end
+
+complete -c ch -n '__fish_use_subcommand' -a '{{.Words .Commands}}'
+complete -c ch -a '(__ch_complete_colors)'
+{{- range .Flags}}
+complete -c ch {{if eq (len .Name) 1}}-s{{else}}-l{{end}} {{.Name}}{{if .TakesArg}} -r{{end}}{{if .ArgValues}} -x -a '{{$.Words .ArgValues}}'{{end}} -d '{{.Quoted}}'
+{{- end}}
+`,
+	"powershell": `# PowerShell completion for ch
+# Load with: ch completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName ch -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $commands = @({{range $i, $c := .Commands}}{{if $i}}, {{end}}'{{$c}}'{{end}})
+    $flags = @({{range $i, $f := .Flags}}{{if $i}}, {{end}}'{{$f.Dash}}'{{end}})
+    $colors = @({{range $i, $c := .Colors}}{{if $i}}, {{end}}'{{$c}}'{{end}})
+    $values = @{
+{{- range .Flags}}{{if .ArgValues}}
+        '{{.Dash}}' = @({{range $i, $v := .ArgValues}}{{if $i}}, {{end}}'{{$v}}'{{end}})
+{{- end}}{{end}}
+    }
+
+    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    if ($wordToComplete) { $prev = $elements[-2] } else { $prev = $elements[-1] }
+
+    $candidates = @()
+    if ($wordToComplete -like '*::*') {
+        $prefix = $wordToComplete.Substring(0, $wordToComplete.LastIndexOf('::') + 2)
+        $candidates = $colors | ForEach-Object { $prefix + $_ }
+    } elseif ($values.ContainsKey($prev)) {
+        $candidates = $values[$prev]
+    } elseif ($wordToComplete -like '-*') {
+        $candidates = $flags
+    } elseif ($elements.Count -le 2) {
+        $candidates = $commands
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+// runCompletion implements `ch completion <shell>`.
+func runCompletion(w io.Writer, shell string, fs *flag.FlagSet, cfg *config) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell '%s' (want bash, zsh, fish or powershell)", shell)
+	}
+	tmpl := template.Must(template.New(shell).Parse(script))
+	return tmpl.Execute(w, buildCompletionData(fs, cfg))
+}
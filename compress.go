@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressions are the formats of compressed files read transparently,
+// recognized by their magic numbers rather than their extensions, so rotated
+// logs like app.log.1 are found too.
+var compressions = []struct {
+	magic []byte
+	open  func(r io.Reader) (io.Reader, func(), error)
+}{
+	{[]byte{0x1f, 0x8b}, func(r io.Reader) (io.Reader, func(), error) {
+		zr, err := gzip.NewReader(r)
+		return zr, func() {}, err
+	}},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, func(r io.Reader) (io.Reader, func(), error) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	}},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, func(r io.Reader) (io.Reader, func(), error) {
+		zr, err := xz.NewReader(r)
+		return zr, func() {}, err
+	}},
+	{[]byte("BZh"), func(r io.Reader) (io.Reader, func(), error) {
+		return bzip2.NewReader(r), func() {}, nil
+	}},
+}
+
+// decompressedFile reads a compressed file's contents.
+type decompressedFile struct {
+	io.Reader
+	f     *os.File
+	close func()
+}
+
+func (d *decompressedFile) Close() error {
+	d.close()
+	return d.f.Close()
+}
+
+// decompress returns a reader of f's decompressed contents if f is in one of
+// the compressions, or nil if it isn't compressed.
+func decompress(f *os.File) (io.ReadCloser, error) {
+	head := make([]byte, 6)
+	n, _ := f.ReadAt(head, 0)
+	for _, c := range compressions {
+		if !bytes.HasPrefix(head[:n], c.magic) {
+			continue
+		}
+		r, close, err := c.open(f)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedFile{Reader: r, f: f, close: close}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the user configuration file, by default
+// $XDG_CONFIG_HOME/ch/config.yaml.
+type config struct {
+	// Theme selects the color theme when --theme is not given
+	Theme string `yaml:"theme"`
+	// Palette selects the auto-assignment palette when --palette is not given
+	Palette string `yaml:"palette"`
+	// Palettes defines custom named palettes
+	Palettes map[string][]paletteEntry `yaml:"palettes"`
+}
+
+// paletteEntry is one named color of a user-defined palette.
+type paletteEntry struct {
+	Name  string `yaml:"name"`
+	Color string `yaml:"color"`
+}
+
+// configDir returns the ch configuration directory, honoring XDG_CONFIG_HOME.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "ch")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "ch")
+}
+
+// configPath returns the config file location. CH_CONFIG overrides the
+// default path.
+func configPath() string {
+	if path := os.Getenv("CH_CONFIG"); path != "" {
+		return path
+	}
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "config.yaml")
+	}
+	return ""
+}
+
+// loadConfig reads the config file. A missing file yields an empty config.
+func loadConfig() (*config, error) {
+	cfg := &config{}
+	path := configPath()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// userPalette converts a palette from the config file, validating its colors.
+func userPalette(name string, entries []paletteEntry) ([]namedColor, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("palette '%s' has no colors", name)
+	}
+	var colors []namedColor
+	for _, e := range entries {
+		r, g, b, err := parseRGB(e.Color)
+		if err != nil {
+			return nil, fmt.Errorf("palette '%s': invalid color '%s' for '%s': %v", name, e.Color, e.Name, err)
+		}
+		colors = append(colors, namedColor{name: e.Name, r: r, g: g, b: b})
+	}
+	return colors, nil
+}
+
+// selectPalette resolves the palette named by the --palette flag or the
+// config file. User-defined palettes take precedence over built-in ones.
+func selectPalette(name string, cfg *config) ([]namedColor, error) {
+	if name == "" {
+		name = cfg.Palette
+	}
+	if name == "" {
+		name = "default"
+	}
+
+	if entries, ok := cfg.Palettes[name]; ok {
+		return userPalette(name, entries)
+	}
+	if p, ok := palettes[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown palette '%s'", name)
+}
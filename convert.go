@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// convertFormats are the formats `ch convert` writes.
+var convertFormats = []string{"asciicast", "html"}
+
+// convertedLine is a highlighted record of a session, with when it was
+// recorded.
+type convertedLine struct {
+	at   time.Duration
+	text string
+}
+
+// runConvert implements `ch convert`: it highlights a recorded session and
+// writes it to w as an asciinema cast or a self-contained HTML page.
+func runConvert(w io.Writer, o *options, m *matcher, path, format string) error {
+	out := make(chan record, 64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- o.readSession(path, out)
+		close(out)
+	}()
+	var lines []convertedLine
+	for rec := range out {
+		if rec.eof {
+			continue
+		}
+		text, _ := o.format(m, rec)
+		if text != "" {
+			lines = append(lines, convertedLine{at: rec.at, text: text})
+		}
+	}
+	if err := <-errc; err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if format == "asciicast" {
+		return writeAsciicast(w, lines, path)
+	}
+	return writeHTML(w, lines, path, o.theme == "light")
+}
+
+// asciicastHeight is the terminal height recorded in casts.
+const asciicastHeight = 24
+
+// writeAsciicast writes lines as an asciicast v2 recording, playable with
+// asciinema play or the asciinema web player. The terminal is as wide as the
+// widest line, within reason.
+func writeAsciicast(w io.Writer, lines []convertedLine, title string) error {
+	width := 80
+	for _, line := range lines {
+		for _, row := range strings.Split(line.text, "\n") {
+			width = max(width, displayWidth(row))
+		}
+	}
+	header, _ := json.Marshal(map[string]any{
+		"version": 2,
+		"width":   min(width, 250),
+		"height":  asciicastHeight,
+		"title":   title,
+		"env":     map[string]string{"TERM": "xterm-256color"},
+	})
+	if _, err := fmt.Fprintf(w, "%s\n", header); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		event, _ := json.Marshal([]any{line.at.Seconds(), "o", strings.ReplaceAll(line.text, "\n", "\r\n")})
+		if _, err := fmt.Fprintf(w, "%s\n", event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHTML writes lines as a standalone HTML page, with the colors as
+// inline styles. Hovering a line shows when it was recorded.
+func writeHTML(w io.Writer, lines []convertedLine, title string, light bool) error {
+	background, foreground := "#1e1e1e", "#d4d4d4"
+	if light {
+		background, foreground = "#ffffff", "#1e1e1e"
+	}
+	var page strings.Builder
+	fmt.Fprintf(&page, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { margin: 0; background: %s; color: %s; }
+pre { margin: 0; padding: 1em; font: 13px/1.4 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<pre>`, html.EscapeString(title), background, foreground)
+	for _, line := range lines {
+		fmt.Fprintf(&page, `<span title="+%.3fs">%s</span>`, line.at.Seconds(), ansiToHTML(line.text))
+	}
+	page.WriteString("</pre>\n</body>\n</html>\n")
+	_, err := io.WriteString(w, page.String())
+	return err
+}
+
+// sgrState is the text style set by SGR escape sequences.
+type sgrState struct {
+	fg, bg                       string
+	bold, dim, italic, underline bool
+}
+
+// style returns the CSS for the state, or "" for the default style.
+func (s sgrState) style() string {
+	var css []string
+	if s.fg != "" {
+		css = append(css, "color:"+s.fg)
+	}
+	if s.bg != "" {
+		css = append(css, "background:"+s.bg)
+	}
+	if s.bold {
+		css = append(css, "font-weight:bold")
+	}
+	if s.dim {
+		css = append(css, "opacity:.6")
+	}
+	if s.italic {
+		css = append(css, "font-style:italic")
+	}
+	if s.underline {
+		css = append(css, "text-decoration:underline")
+	}
+	return strings.Join(css, ";")
+}
+
+// apply updates the state with the parameters of an SGR sequence.
+func (s *sgrState) apply(params []int) {
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	for i := 0; i < len(params); i++ {
+		switch p := params[i]; {
+		case p == 0:
+			*s = sgrState{}
+		case p == 1:
+			s.bold = true
+		case p == 2:
+			s.dim = true
+		case p == 3:
+			s.italic = true
+		case p == 4:
+			s.underline = true
+		case p == 22:
+			s.bold, s.dim = false, false
+		case p == 23:
+			s.italic = false
+		case p == 24:
+			s.underline = false
+		case p >= 30 && p <= 37:
+			s.fg = ansi256(p - 30)
+		case p >= 90 && p <= 97:
+			s.fg = ansi256(p - 90 + 8)
+		case p == 39:
+			s.fg = ""
+		case p >= 40 && p <= 47:
+			s.bg = ansi256(p - 40)
+		case p >= 100 && p <= 107:
+			s.bg = ansi256(p - 100 + 8)
+		case p == 49:
+			s.bg = ""
+		case p == 38 || p == 48:
+			var color string
+			switch {
+			case i+2 < len(params) && params[i+1] == 5:
+				color = ansi256(params[i+2])
+				i += 2
+			case i+4 < len(params) && params[i+1] == 2:
+				color = fmt.Sprintf("#%02x%02x%02x", params[i+2]&0xff, params[i+3]&0xff, params[i+4]&0xff)
+				i += 4
+			default:
+				return
+			}
+			if p == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+}
+
+// basicColors are the xterm defaults for the 16 basic ANSI colors.
+var basicColors = []string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// ansi256 returns the CSS color of an entry of the xterm 256-color palette.
+func ansi256(n int) string {
+	switch {
+	case n < 0 || n > 255:
+		return ""
+	case n < 16:
+		return basicColors[n]
+	case n < 232:
+		// 6x6x6 color cube
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		n -= 16
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	}
+	gray := 8 + (n-232)*10
+	return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+}
+
+// ansiToHTML converts text colored with SGR escape sequences to escaped HTML
+// with styled spans. Other escape sequences are dropped.
+func ansiToHTML(s string) string {
+	var (
+		out   strings.Builder
+		state sgrState
+		open  bool
+	)
+	last := 0
+	flush := func(end int) {
+		if end > last {
+			out.WriteString(html.EscapeString(s[last:end]))
+		}
+	}
+	for _, loc := range ansiEscape.FindAllStringIndex(s, -1) {
+		flush(loc[0])
+		last = loc[1]
+		seq := s[loc[0]:loc[1]]
+		if !strings.HasPrefix(seq, "\x1b[") || !strings.HasSuffix(seq, "m") {
+			continue
+		}
+		var params []int
+		for _, field := range strings.FieldsFunc(seq[2:len(seq)-1], func(r rune) bool { return r == ';' || r == ':' }) {
+			n, _ := strconv.Atoi(field)
+			params = append(params, n)
+		}
+		state.apply(params)
+		if open {
+			out.WriteString("</span>")
+			open = false
+		}
+		if style := state.style(); style != "" {
+			fmt.Fprintf(&out, `<span style="%s">`, style)
+			open = true
+		}
+	}
+	flush(len(s))
+	if open {
+		out.WriteString("</span>")
+	}
+	return out.String()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// cutSpec is the --cut selection: ranges of whitespace-separated columns,
+// counted from 1, or the names of fields.
+type cutSpec struct {
+	ranges [][2]int // inclusive; an end of 0 runs to the last column
+	names  []string
+}
+
+// parseCut parses a --cut list such as 1,3,5-7,9- of columns, or ts,level,msg
+// of fields.
+func parseCut(list string) (*cutSpec, error) {
+	if list == "" {
+		return nil, nil
+	}
+	spec := &cutSpec{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("invalid --cut '%s' (empty column)", list)
+		}
+		if !strings.ContainsFunc(item[:1], unicode.IsDigit) {
+			spec.names = append(spec.names, item)
+			continue
+		}
+		from, to, isRange := strings.Cut(item, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("invalid --cut column '%s' (columns count from 1)", item)
+		}
+		end := start
+		if isRange {
+			end = 0
+			if to != "" {
+				if end, err = strconv.Atoi(to); err != nil || end < start {
+					return nil, fmt.Errorf("invalid --cut range '%s'", item)
+				}
+			}
+		}
+		spec.ranges = append(spec.ranges, [2]int{start, end})
+	}
+	if len(spec.names) > 0 && len(spec.ranges) > 0 {
+		return nil, fmt.Errorf("invalid --cut '%s' (use either column numbers or field names)", list)
+	}
+	return spec, nil
+}
+
+// cutLine keeps the --cut columns or fields of line, in the order given,
+// separated by spaces. Fields are found as for --template, and lines without
+// any are left alone.
+func (o *options) cutLine(line string) string {
+	if o.cutSpec == nil {
+		return line
+	}
+	var kept []string
+	if len(o.cutSpec.names) > 0 {
+		fields := o.parseFields(line)
+		if len(fields) == 0 {
+			return line
+		}
+		for _, name := range o.cutSpec.names {
+			if value, ok := fields[name]; ok {
+				kept = append(kept, value)
+			}
+		}
+		return strings.Join(kept, " ")
+	}
+	columns := strings.Fields(line)
+	for _, r := range o.cutSpec.ranges {
+		end := r[1]
+		if end == 0 || end > len(columns) {
+			end = len(columns)
+		}
+		for i := r[0]; i <= end; i++ {
+			kept = append(kept, columns[i-1])
+		}
+	}
+	return strings.Join(kept, " ")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// diffOp says where a line of a diff comes from.
+type diffOp int
+
+const (
+	diffKeep   diffOp = iota // in both inputs
+	diffRemove               // only in the first input
+	diffAdd                  // only in the second input
+)
+
+// diffLine is a line of a diff.
+type diffLine struct {
+	op  diffOp
+	rec record
+}
+
+// diffRecords aligns a and b, returning the shortest edit script that turns
+// a into b, found with Myers' algorithm. Records are compared by their key.
+func diffRecords(a, b []record, key func(string) string) []diffLine {
+	ka := make([]string, len(a))
+	for i, rec := range a {
+		ka[i] = key(rec.text)
+	}
+	kb := make([]string, len(b))
+	for i, rec := range b {
+		kb[i] = key(rec.text)
+	}
+
+	// v holds, for each diagonal k = x-y, the furthest x reached so far. The
+	// diagonals reached after each round are kept to trace the path back.
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; ; d++ {
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && ka[x] == kb[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+		if done {
+			break
+		}
+	}
+
+	var lines []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prevX, prevY := 0, 0
+		if d > 0 {
+			prev := trace[d-1] // diagonals -(d-1) to d-1
+			k := x - y
+			prevK := k - 1
+			if k == -d || k != d && prev[k-1+d-1] < prev[k+1+d-1] {
+				prevK = k + 1
+			}
+			prevX = prev[prevK+d-1]
+			prevY = prevX - prevK
+		}
+		for x > prevX && y > prevY {
+			x--
+			y--
+			lines = append(lines, diffLine{op: diffKeep, rec: b[y]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			lines = append(lines, diffLine{op: diffAdd, rec: b[prevY]})
+		} else {
+			lines = append(lines, diffLine{op: diffRemove, rec: a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(lines)
+	return lines
+}
+
+// maskTimestamps replaces the timestamps in line, so lines from different
+// runs compare equal if only their times differ.
+func maskTimestamps(line string) string {
+	for _, f := range timestampFormats {
+		line = f.re.ReplaceAllString(line, "<time>")
+	}
+	return line
+}
+
+// readAllRecords reads every record of the file at path, which may be
+// compressed or a recorded session.
+func (o *options) readAllRecords(path string) ([]record, error) {
+	if isSession(path) {
+		return collectRecords(func(out chan<- record) error {
+			return o.readSession(path, out)
+		})
+	}
+	r, _, err := o.openFile(path)
+	if errors.Is(err, errBinary) {
+		return nil, fmt.Errorf("%s: binary file (read it with --binary)", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	records, err := collectRecords(func(out chan<- record) error {
+		return o.readRecords(r, path, tailStart{}, out)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return records, nil
+}
+
+// collectRecords gathers the records read sends.
+func collectRecords(read func(out chan<- record) error) ([]record, error) {
+	out := make(chan record, 64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- read(out)
+		close(out)
+	}()
+	var records []record
+	for rec := range out {
+		if !rec.eof {
+			records = append(records, rec)
+		}
+	}
+	return records, <-errc
+}
+
+// Colors of removed and added lines: the marker is bright, and the text is
+// tinted muted so highlights stand out from it.
+var (
+	diffRemoveColor = rgbToANSI(255, 105, 97, false)
+	diffAddColor    = rgbToANSI(134, 194, 29, false)
+	diffRemoveTint  = diffTint(0)
+	diffAddTint     = diffTint(100)
+)
+
+// diffTint returns the muted text color of changed lines at hue.
+func diffTint(hue float64) string {
+	r, g, b := hslToRGB(hue, tintSaturation, rainbowLightness)
+	return rgbToANSI(r, g, b, false)
+}
+
+// runDiff implements `ch diff`: it aligns the files at pathA and pathB and
+// writes the lines of both, marking removed and added ones, with the rules
+// highlighted within the changed lines.
+func runDiff(w io.Writer, o *options, m *matcher, pathA, pathB string) error {
+	a, err := o.readAllRecords(pathA)
+	if err != nil {
+		return err
+	}
+	b, err := o.readAllRecords(pathB)
+	if err != nil {
+		return err
+	}
+	key := func(text string) string { return text }
+	if o.ignoreTimestamps {
+		key = maskTimestamps
+	}
+
+	fmt.Fprintf(w, "%s--- %s%s\n", diffRemoveColor, pathA, Reset)
+	fmt.Fprintf(w, "%s+++ %s%s\n", diffAddColor, pathB, Reset)
+	for _, line := range diffRecords(a, b, key) {
+		end := line.rec.end
+		if end == "" {
+			end = "\n"
+		}
+		text := o.prepare(line.rec.text)
+		if line.op == diffKeep {
+			fmt.Fprint(w, o.layout("  "+text)+end)
+			continue
+		}
+		marker, opts := diffAddColor+"+"+Reset+" ", m.opts
+		opts.tint = diffAddTint
+		if line.op == diffRemove {
+			marker, opts.tint = diffRemoveColor+"-"+Reset+" ", diffRemoveTint
+		}
+		fmt.Fprint(w, o.layout(marker+opts.render(text, m.find(text)))+end)
+	}
+	return nil
+}
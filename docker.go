@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultDockerHost is the Docker daemon's socket when DOCKER_HOST isn't set.
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerClient returns an HTTP client that talks to the Docker daemon at
+// DOCKER_HOST, and the base URL of its API.
+func dockerClient() (*http.Client, string, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	scheme, addr, _ := strings.Cut(host, "://")
+	switch scheme {
+	case "unix":
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+			},
+		}}, "http://docker", nil
+	case "tcp":
+		return &http.Client{}, "http://" + addr, nil
+	}
+	return nil, "", fmt.Errorf("unsupported DOCKER_HOST '%s' (use unix:// or tcp://)", host)
+}
+
+// dockerGet requests an API path from the Docker daemon, turning error
+// responses into errors with the daemon's message.
+func dockerGet(client *http.Client, base, path string) (*http.Response, error) {
+	resp, err := client.Get(base + path)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to Docker: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body struct{ Message string }
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body)
+		if body.Message == "" {
+			body.Message = resp.Status
+		}
+		return nil, fmt.Errorf("docker: %s", body.Message)
+	}
+	return resp, nil
+}
+
+// readDocker follows the logs of the containers given to `ch docker`, each
+// record tagged with its container's name, starting with the last --tail
+// lines of each.
+func (o *options) readDocker(out chan<- record) error {
+	client, base, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	tail := o.tail
+	if tail == 0 {
+		tail = defaultFollowTail
+	}
+
+	return followAll(o.containers, func(container string) error {
+		return o.followContainer(client, base, container, tail, out)
+	})
+}
+
+// followContainer streams one container's stdout and stderr as records.
+func (o *options) followContainer(client *http.Client, base, container string, tail int, out chan<- record) error {
+	resp, err := dockerGet(client, base, "/containers/"+url.PathEscape(container)+"/json")
+	if err != nil {
+		return err
+	}
+	var info struct {
+		Config struct{ Tty bool }
+	}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}, "tail": {strconv.Itoa(tail)}}
+	resp, err = dockerGet(client, base, "/containers/"+url.PathEscape(container)+"/logs?"+query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if info.Config.Tty {
+		return o.readRecords(resp.Body, container, tailStart{}, out)
+	}
+
+	// Without a TTY, stdout and stderr are multiplexed in frames; read each
+	// through its own pipe so their partial lines don't mix
+	stdout, stdoutW := io.Pipe()
+	stderr, stderrW := io.Pipe()
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o.readRecords(r, container, tailStart{}, out)
+			io.Copy(io.Discard, r)
+		}()
+	}
+	err = demuxDockerStream(resp.Body, stdoutW, stderrW)
+	stdoutW.Close()
+	stderrW.Close()
+	wg.Wait()
+	return err
+}
+
+// demuxDockerStream splits a multiplexed log stream into stdout and stderr.
+// Each frame has an 8-byte header: the stream, 3 zero bytes and the length of
+// the payload, big-endian.
+func demuxDockerStream(r io.Reader, stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/sharunkumar/ch/version"
+)
+
+// colorDepth guesses how many colors the terminal supports from the
+// environment, the same way most terminal-aware tools do.
+func colorDepth() string {
+	colorterm := strings.ToLower(os.Getenv("COLORTERM"))
+	termName := os.Getenv("TERM")
+	switch {
+	case colorterm == "truecolor" || colorterm == "24bit":
+		return "truecolor (24-bit)"
+	case os.Getenv("WT_SESSION") != "":
+		return "truecolor (24-bit, Windows Terminal)"
+	case strings.Contains(termName, "256color"):
+		return "256 colors (truecolor may be approximated)"
+	case termName == "dumb":
+		return "none (TERM=dumb)"
+	case termName == "":
+		return "unknown (TERM not set)"
+	default:
+		return "16 colors (truecolor may be approximated)"
+	}
+}
+
+// ttyStatus describes whether the file descriptor is a terminal.
+func ttyStatus(f *os.File) string {
+	if term.IsTerminal(int(f.Fd())) {
+		return "terminal"
+	}
+	return "not a terminal (pipe or file)"
+}
+
+// envOrUnset formats an environment variable for the report.
+func envOrUnset(name string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return fmt.Sprintf("%q", v)
+	}
+	return "(unset)"
+}
+
+// printTestPattern renders samples at each color depth so users can see
+// which ones their terminal displays correctly.
+func printTestPattern(w io.Writer) {
+	fmt.Fprint(w, "  16 colors:  ")
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(w, "\033[4%dm  \033[10%dm  ", i, i)
+	}
+	fmt.Fprintln(w, Reset)
+
+	fmt.Fprint(w, "  256 colors: ")
+	for i := 16; i < 232; i += 6 {
+		fmt.Fprintf(w, "\033[48;5;%dm ", i)
+	}
+	fmt.Fprintln(w, Reset)
+
+	fmt.Fprint(w, "  truecolor:  ")
+	for i := 0; i < 36; i++ {
+		r, g, b := hslToRGB(float64(i*10), 0.8, 0.5)
+		fmt.Fprintf(w, "%s ", rgbToANSI(r, g, b, true))
+	}
+	fmt.Fprintln(w, Reset)
+	fmt.Fprintln(w, "  (the truecolor row should be a smooth rainbow, not bands of a few colors)")
+
+	fmt.Fprint(w, "  presets:    ")
+	for _, nc := range palette {
+		fmt.Fprintf(w, "%s%s%s ", rgbToANSI(nc.r, nc.g, nc.b, false), nc.name, Reset)
+	}
+	fmt.Fprintln(w)
+}
+
+// runDoctor implements `ch doctor`: it reports the terminal environment
+// relevant to color output and renders a test pattern, to help debug
+// "why are my colors wrong" reports.
+func runDoctor(w io.Writer) {
+	report := func(name, value string) {
+		fmt.Fprintf(w, "  %-22s %s\n", name, value)
+	}
+
+	fmt.Fprintln(w, "Build:")
+	info := version.Get()
+	report("version", info.Version)
+	report("platform", info.Platform)
+
+	fmt.Fprintln(w, "\nTerminal:")
+	report("TERM", envOrUnset("TERM"))
+	report("TERM_PROGRAM", envOrUnset("TERM_PROGRAM"))
+	report("COLORTERM", envOrUnset("COLORTERM"))
+	report("color depth", colorDepth())
+	report("stdin", ttyStatus(os.Stdin))
+	report("stdout", ttyStatus(os.Stdout))
+	report("stderr", ttyStatus(os.Stderr))
+	if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		report("size", fmt.Sprintf("%dx%d", width, height))
+	}
+	report("Windows VT processing", virtualTerminalStatus())
+
+	fmt.Fprintln(w, "\nColor settings:")
+	noColor := envOrUnset("NO_COLOR")
+	if noColor != "(unset)" {
+		noColor += " (ch always emits colors; other tools may disable theirs)"
+	}
+	report("NO_COLOR", noColor)
+	report("COLORFGBG", envOrUnset("COLORFGBG"))
+	if r, g, b, ok := queryBackground(); ok {
+		report("background (OSC 11)", fmt.Sprintf("#%02X%02X%02X, luminance %.2f", r, g, b, luminance(r, g, b)))
+	} else {
+		report("background (OSC 11)", "no reply (terminal doesn't support the query, or stdout isn't a terminal)")
+	}
+	report("auto theme", detectTheme())
+	configFile := configPath()
+	if _, err := os.Stat(configFile); err != nil {
+		configFile += " (not found)"
+	}
+	report("config file", configFile)
+
+	fmt.Fprintln(w, "\nTest pattern:")
+	printTestPattern(w)
+}
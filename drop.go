@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseDrop compiles the --drop patterns and --drop-field names into
+// substitutions that replace what they match with a placeholder.
+func (o *options) parseDrop() ([]substitution, error) {
+	var subs []substitution
+	for _, pattern := range o.drop {
+		regex := !o.fixedStrings && isRegexRule(pattern)
+		cs := o.caseSensitive || o.smartCase && hasUppercase(pattern, regex)
+		cond, err := condition(pattern, cs, o.fixedStrings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --drop pattern: %v", err)
+		}
+		subs = append(subs, substitution{pattern: cond, color: dimColor, drop: true})
+	}
+	for _, name := range o.dropFields {
+		if name == "" {
+			return nil, fmt.Errorf("--drop-field needs a field name")
+		}
+		subs = append(subs, substitution{field: name, color: dimColor, drop: true})
+	}
+	return subs, nil
+}
+
+// dropPlaceholder stands in for n dropped bytes.
+func dropPlaceholder(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("…(%d B)", n)
+	}
+	if n < 1024*1024 {
+		return fmt.Sprintf("…(%.1f KB)", float64(n)/1024)
+	}
+	return fmt.Sprintf("…(%.1f MB)", float64(n)/(1024*1024))
+}
+
+// fieldEdits finds the values of the field name in text, both as a JSON key,
+// where the value can be a whole object or array, and as a logfmt key=value
+// pair.
+func fieldEdits(text, name string) []edit {
+	var edits []edit
+	pos := 0
+	for pos < len(text) {
+		i := indexField(text[pos:], name)
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		end := skipValue(text, start)
+		if end > start {
+			edits = append(edits, edit{start: start, end: end})
+		}
+		pos = max(end, start+1)
+	}
+	return edits
+}
+
+// indexField returns where the value of the first "name": or name= in text
+// starts, or -1.
+func indexField(text, name string) int {
+	quoted := `"` + name + `"`
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], quoted):
+			j := i + len(quoted)
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+				j++
+			}
+			if j < len(text) && text[j] == ':' {
+				j++
+				for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+					j++
+				}
+				return j
+			}
+		case strings.HasPrefix(text[i:], name+"=") && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return i + len(name) + 1
+		}
+	}
+	return -1
+}
+
+// skipValue returns where the value starting at text[start] ends: a quoted
+// string, a JSON object or array with everything nested in it, or a bare
+// word up to a space, comma or closing bracket.
+func skipValue(text string, start int) int {
+	depth := 0
+	inString := false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+			if !inString && depth == 0 {
+				return i + 1
+			}
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case depth == 0 && (c == ' ' || c == '\t' || c == ','):
+			return i
+		}
+	}
+	return len(text)
+}
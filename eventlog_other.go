@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// readEventLog is only available on Windows.
+func (o *options) readEventLog(out chan<- record) error {
+	return fmt.Errorf("--eventlog reads the Windows Event Log, which only exists on Windows")
+}
@@ -0,0 +1,177 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// The Windows Event Log API (wevtapi.dll), which x/sys/windows doesn't wrap.
+var (
+	wevtapi                      = windows.NewLazySystemDLL("wevtapi.dll")
+	procEvtSubscribe             = wevtapi.NewProc("EvtSubscribe")
+	procEvtNext                  = wevtapi.NewProc("EvtNext")
+	procEvtRender                = wevtapi.NewProc("EvtRender")
+	procEvtOpenPublisherMetadata = wevtapi.NewProc("EvtOpenPublisherMetadata")
+	procEvtFormatMessage         = wevtapi.NewProc("EvtFormatMessage")
+	procEvtClose                 = wevtapi.NewProc("EvtClose")
+)
+
+const (
+	evtSubscribeToFutureEvents = 1
+	evtRenderEventXML          = 1
+	evtFormatMessageEvent      = 1
+	eventBatchSize             = 16
+)
+
+// readEventLog subscribes to the --eventlog channel, such as Application or
+// System, and sends each new event as a record.
+func (o *options) readEventLog(out chan<- record) error {
+	signal, err := windows.CreateEvent(nil, 1, 1, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(signal)
+
+	channel, err := windows.UTF16PtrFromString(o.eventLog)
+	if err != nil {
+		return err
+	}
+	query, _ := windows.UTF16PtrFromString("*")
+	sub, _, err := procEvtSubscribe.Call(0, uintptr(signal), uintptr(unsafe.Pointer(channel)), uintptr(unsafe.Pointer(query)), 0, 0, 0, evtSubscribeToFutureEvents)
+	if sub == 0 {
+		return fmt.Errorf("subscribing to the %s event log: %v", o.eventLog, err)
+	}
+	defer procEvtClose.Call(sub)
+	fmt.Fprintf(os.Stderr, "ch: waiting for events in the %s event log\n", o.eventLog)
+
+	events := make([]uintptr, eventBatchSize)
+	for {
+		if _, err := windows.WaitForSingleObject(signal, windows.INFINITE); err != nil {
+			return err
+		}
+		for {
+			var returned uint32
+			ok, _, err := procEvtNext.Call(sub, uintptr(len(events)), uintptr(unsafe.Pointer(&events[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+			if ok == 0 {
+				if errors.Is(err, windows.ERROR_NO_MORE_ITEMS) || errors.Is(err, windows.ERROR_TIMEOUT) {
+					windows.ResetEvent(signal)
+					break
+				}
+				return fmt.Errorf("reading the %s event log: %v", o.eventLog, err)
+			}
+			for _, event := range events[:returned] {
+				text, err := renderEvent(event)
+				procEvtClose.Call(event)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+					continue
+				}
+				out <- record{text: text, end: "\n"}
+			}
+		}
+	}
+}
+
+// eventXML holds the parts of an event's XML rendering that are shown.
+type eventXML struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		}
+		EventID     int
+		Level       int
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		}
+		Computer string
+	}
+	EventData struct {
+		Data []string
+	}
+}
+
+// eventLevels are the names of the standard event levels, indexed by value.
+// Level 0 is logged always and shown as information, as Event Viewer does.
+var eventLevels = []string{"information", "critical", "error", "warning", "information", "verbose"}
+
+// renderEvent formats an event like a syslog line: time, computer, level
+// name, provider and event ID, then the message.
+func renderEvent(event uintptr) (string, error) {
+	raw, err := evtCall(func(size uint32, buf *uint16, used *uint32) (uintptr, error) {
+		var props uint32
+		ok, _, err := procEvtRender.Call(0, event, evtRenderEventXML, uintptr(size*2), uintptr(unsafe.Pointer(buf)), uintptr(unsafe.Pointer(used)), uintptr(unsafe.Pointer(&props)))
+		// EvtRender counts bytes rather than characters
+		*used = (*used + 1) / 2
+		return ok, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("rendering event: %v", err)
+	}
+	var e eventXML
+	if err := xml.Unmarshal([]byte(raw), &e); err != nil {
+		return "", fmt.Errorf("parsing event: %v", err)
+	}
+
+	message := formatEventMessage(e.System.Provider.Name, event)
+	if message == "" {
+		message = strings.Join(e.EventData.Data, " ")
+	}
+	var parts []string
+	if t, err := time.Parse(time.RFC3339Nano, e.System.TimeCreated.SystemTime); err == nil {
+		parts = append(parts, t.Local().Format(time.Stamp))
+	}
+	parts = append(parts, e.System.Computer)
+	if e.System.Level >= 0 && e.System.Level < len(eventLevels) {
+		parts = append(parts, eventLevels[e.System.Level])
+	}
+	parts = append(parts, fmt.Sprintf("%s[%d]:", e.System.Provider.Name, e.System.EventID), message)
+	return strings.Join(parts, " "), nil
+}
+
+// formatEventMessage returns the event's message as its provider words it,
+// or "" if the provider's message table isn't available.
+func formatEventMessage(provider string, event uintptr) string {
+	name, err := windows.UTF16PtrFromString(provider)
+	if err != nil {
+		return ""
+	}
+	meta, _, _ := procEvtOpenPublisherMetadata.Call(0, uintptr(unsafe.Pointer(name)), 0, 0, 0)
+	if meta == 0 {
+		return ""
+	}
+	defer procEvtClose.Call(meta)
+	message, err := evtCall(func(size uint32, buf *uint16, used *uint32) (uintptr, error) {
+		ok, _, err := procEvtFormatMessage.Call(meta, event, 0, 0, 0, evtFormatMessageEvent, uintptr(size), uintptr(unsafe.Pointer(buf)), uintptr(unsafe.Pointer(used)))
+		return ok, err
+	})
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(message)
+}
+
+// evtCall calls an Event Log function that writes a string to a buffer,
+// growing the buffer to the size it asks for.
+func evtCall(call func(size uint32, buf *uint16, used *uint32) (uintptr, error)) (string, error) {
+	buf := make([]uint16, 1024)
+	for {
+		var used uint32
+		ok, err := call(uint32(len(buf)), &buf[0], &used)
+		if ok != 0 {
+			return windows.UTF16ToString(buf), nil
+		}
+		if !errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) || int(used) <= len(buf) {
+			return "", err
+		}
+		buf = make([]uint16, used)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// explainer traces match decisions for --explain: which rule matched where,
+// how matches were extended, and which overlapping matches were discarded.
+// A nil *explainer discards the trace.
+type explainer struct {
+	w    io.Writer
+	line int
+}
+
+// nextLine starts tracing a new input line.
+func (e *explainer) nextLine(line string) {
+	if e == nil {
+		return
+	}
+	e.line++
+	fmt.Fprintf(e.w, "ch: line %d: %q\n", e.line, line)
+}
+
+// logf writes one trace entry for the current line.
+func (e *explainer) logf(format string, args ...any) {
+	if e == nil {
+		return
+	}
+	fmt.Fprintf(e.w, "ch:   "+format+"\n", args...)
+}
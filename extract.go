@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// extractor collects the values of --extract for --unique and --count.
+type extractor struct {
+	patterns []wordConfig
+	seen     map[string]int // how often each value was found
+	order    []string       // values in the order they were first found
+}
+
+// parseExtract compiles the --extract patterns. They are matched like rules,
+// as literals or /regex/, and follow -s and -S.
+func (o *options) parseExtract() (*extractor, error) {
+	if len(o.extract) == 0 {
+		return nil, nil
+	}
+	x := &extractor{seen: make(map[string]int)}
+	for _, pattern := range o.extract {
+		regex := !o.fixedStrings && isRegexRule(pattern)
+		cs := o.caseSensitive || o.smartCase && hasUppercase(pattern, regex)
+		cond, err := condition(pattern, cs, o.fixedStrings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --extract pattern: %v", err)
+		}
+		x.patterns = append(x.patterns, cond)
+	}
+	return x, nil
+}
+
+// values returns what the patterns extract from line, in order of pattern:
+// for a regex, its capture groups, separated by tabs, or only the group of a
+// $N suffix, and otherwise the whole match.
+func (x *extractor) values(line string) []string {
+	var values []string
+	for _, cfg := range x.patterns {
+		if cfg.re == nil || cfg.group > 0 || cfg.re.NumSubexp() == 0 {
+			for _, m := range findMatches(line, cfg) {
+				values = append(values, line[m.start:m.end])
+			}
+			continue
+		}
+		for _, m := range cfg.re.FindAllStringSubmatch(line, -1) {
+			values = append(values, strings.Join(m[1:], "\t"))
+		}
+	}
+	return values
+}
+
+// extractValue colors an extracted value with the rules, or if none of them
+// highlight it, in a color of its own, so equal values look alike.
+func extractValue(m *matcher, value string) string {
+	if replacements := m.find(value); len(replacements) > 0 {
+		return m.opts.render(value, replacements)
+	}
+	return sourceColors([]string{value})[value].prefix + value + Reset
+}
+
+// formatExtract returns the values --extract finds in text, a record, each
+// on its own line after the record's prefix. With --unique, values already
+// seen are left out, and with --count nothing is written until the counts
+// at the end.
+func (o *options) formatExtract(m *matcher, rec record, text string) (string, bool) {
+	values := o.extractor.values(text)
+	var output strings.Builder
+	prefix := o.prefix(rec)
+	for _, value := range values {
+		o.extractor.seen[value]++
+		if o.extractor.seen[value] == 1 {
+			o.extractor.order = append(o.extractor.order, value)
+		} else if o.unique {
+			continue
+		}
+		if !o.count {
+			output.WriteString(o.layout(prefix+extractValue(m, value)) + rec.end)
+		}
+	}
+	return output.String(), len(values) > 0
+}
+
+// writeCounts writes the --count of each extracted value, most frequent
+// first, like sort | uniq -c | sort -rn. Values found as often keep the order
+// they were first found in.
+func (o *options) writeCounts(w io.Writer, m *matcher) {
+	if o.extractor == nil || !o.count {
+		return
+	}
+	values := slices.Clone(o.extractor.order)
+	slices.SortStableFunc(values, func(a, b string) int {
+		return o.extractor.seen[b] - o.extractor.seen[a]
+	})
+	for _, value := range values {
+		fmt.Fprintf(w, "%s%7d%s %s\n", o.numberColor, o.extractor.seen[value], Reset, extractValue(m, value))
+	}
+}
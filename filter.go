@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// parseHide compiles the --hide patterns. They are matched like rules, as
+// literals or /regex/, and follow -s and -S.
+func (o *options) parseHide() ([]wordConfig, error) {
+	var hide []wordConfig
+	for _, pattern := range o.hide {
+		regex := !o.fixedStrings && isRegexRule(pattern)
+		cs := o.caseSensitive || o.smartCase && hasUppercase(pattern, regex)
+		cond, err := condition(pattern, cs, o.fixedStrings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --hide pattern: %v", err)
+		}
+		hide = append(hide, cond)
+	}
+	return hide, nil
+}
+
+// hidden reports whether --hide drops the record.
+func (o *options) hidden(rec record) bool {
+	if len(o.hidePatterns) == 0 {
+		return false
+	}
+	text := o.prepare(rec.text)
+	for _, cond := range o.hidePatterns {
+		if len(findMatches(text, cond)) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -1,3 +1,17 @@
 module github.com/sharunkumar/ch
 
 go 1.24.1
+
+require (
+	github.com/alecthomas/chroma/v2 v2.14.0
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/klauspost/compress v1.18.0
+	github.com/rivo/uniseg v0.4.7
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
+	golang.org/x/text v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/dlclark/regexp2 v1.11.0 // indirect
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/rivo/uniseg"
+)
+
+// graphemeBounds holds the byte offsets where grapheme clusters start in a
+// line, so highlights never split a character from its combining marks or an
+// emoji sequence in two. It is nil for ASCII lines, where every byte is a
+// cluster.
+type graphemeBounds []int
+
+// newGraphemeBounds segments line into grapheme clusters.
+func newGraphemeBounds(line string) graphemeBounds {
+	ascii := true
+	for i := 0; i < len(line); i++ {
+		if line[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return nil
+	}
+
+	var bounds graphemeBounds
+	state := -1
+	for pos := 0; pos < len(line); {
+		bounds = append(bounds, pos)
+		var cluster string
+		cluster, _, _, state = uniseg.FirstGraphemeClusterInString(line[pos:], state)
+		pos += len(cluster)
+	}
+	return append(bounds, len(line))
+}
+
+// snap widens the [start, end) byte range to whole grapheme clusters.
+func (b graphemeBounds) snap(start, end int) (int, int) {
+	if b == nil {
+		return start, end
+	}
+	if i := sort.SearchInts(b, start); i == len(b) || b[i] != start {
+		start = b[i-1]
+	}
+	if i := sort.SearchInts(b, end); i < len(b) {
+		end = b[i]
+	}
+	return start, end
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// iconsFlag is a flag that takes an optional mode, as in --icons or
+// --icons=replace: icons go before the highlights, or replace them.
+type iconsFlag struct {
+	set     bool
+	replace bool
+}
+
+func (f *iconsFlag) String() string {
+	if f.replace {
+		return "replace"
+	}
+	return ""
+}
+
+func (f *iconsFlag) Set(value string) error {
+	switch value {
+	case "true", "prefix":
+		f.set, f.replace = true, false
+	case "replace":
+		f.set, f.replace = true, true
+	case "false":
+		f.set, f.replace = false, false
+	default:
+		return fmt.Errorf("want prefix or replace")
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a mode.
+func (f *iconsFlag) IsBoolFlag() bool { return true }
+
+// Icons of the log levels and outcomes --icons recognizes.
+const (
+	errorIcon   = "❌"
+	warningIcon = "⚠️"
+	successIcon = "✅"
+)
+
+// levelIcons maps level and outcome words, in upper case, to their icons.
+var levelIcons = map[string]string{
+	"ERROR": errorIcon, "ERR": errorIcon, "FATAL": errorIcon, "CRITICAL": errorIcon, "CRIT": errorIcon,
+	"PANIC": errorIcon, "EMERG": errorIcon, "ALERT": errorIcon, "FAIL": errorIcon, "FAILED": errorIcon, "FAILURE": errorIcon,
+	"WARN": warningIcon, "WARNING": warningIcon,
+	"SUCCESS": successIcon, "SUCCEEDED": successIcon, "SUCCESSFUL": successIcon, "OK": successIcon,
+	"PASS": successIcon, "PASSED": successIcon, "DONE": successIcon,
+}
+
+// levelIcon returns the icon of a highlighted level word, such as ERROR or
+// [warn], or "" if the text isn't one.
+func levelIcon(text string) string {
+	word := strings.TrimFunc(text, func(r rune) bool { return !unicode.IsLetter(r) })
+	return levelIcons[strings.ToUpper(word)]
+}
+
+// icon returns the icon to show with a highlight of cfg: the rule's own from
+// its icon= modifier, or with --icons the icon of the level word it matched.
+func (opts highlightOptions) icon(cfg wordConfig, matched string) string {
+	if cfg.iconSet {
+		return cfg.icon
+	}
+	if opts.icons.set {
+		return levelIcon(matched)
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern from a .gitignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	base    string // the directory of the .gitignore file
+	negate  bool   // a !pattern, which re-includes matches
+	dirOnly bool   // a pattern/, which only matches directories
+}
+
+// ignoreList holds the .gitignore rules that apply in a directory, from the
+// outermost file to the innermost.
+type ignoreList []ignoreRule
+
+// withFile returns the list extended with the rules of dir/.gitignore, if
+// there is one.
+func (l ignoreList) withFile(dir string) ignoreList {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return l
+	}
+	rules := l[:len(l):len(l)]
+	for _, line := range strings.Split(string(data), "\n") {
+		if rule, ok := parseIgnoreRule(line, dir); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ignored reports whether path is ignored. As in git, the last matching rule
+// decides.
+func (l ignoreList) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, rule := range l {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if rule.re.MatchString(filepath.ToSlash(rel)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// parseIgnoreRule parses a line of a .gitignore file in dir. It reports false
+// for blank lines and comments.
+func parseIgnoreRule(line, dir string) (ignoreRule, bool) {
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: dir}
+	if strings.HasPrefix(line, "!") {
+		rule.negate, line = true, line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	// A pattern with a slash is relative to the .gitignore file; one without
+	// matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i++
+			re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	var err error
+	if rule.re, err = regexp.Compile(re.String()); err != nil {
+		return ignoreRule{}, false
+	}
+	return rule, true
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// invalidUTF8Modes are the accepted --invalid-utf8 values: pass the bytes
+// through untouched, replace them with U+FFFD, or escape them as \xNN.
+var invalidUTF8Modes = []string{"raw", "replace", "escape"}
+
+// fixUTF8 applies an --invalid-utf8 mode to line.
+func fixUTF8(line, mode string) string {
+	if mode == "raw" || utf8.ValidString(line) {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r != utf8.RuneError || size != 1:
+			b.WriteString(line[i : i+size])
+		case mode == "replace":
+			b.WriteRune(utf8.RuneError)
+		default:
+			fmt.Fprintf(&b, `\x%02X`, line[i])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// prepare applies the input options to a line before it is highlighted.
+// Escape sequences are removed unless --raw-escapes is set, or -A is going
+// to show them as text, tabs are expanded with --expand-tabs and secrets
+// masked with --redact.
+func (o *options) prepare(line string) string {
+	line = fixUTF8(line, o.invalidUTF8)
+	if !o.rawEscapes && !o.showAll {
+		line = sanitizeEscapes(line)
+	}
+	if o.expandTabs > 0 {
+		line = expandTabs(line, o.expandTabs)
+	}
+	if len(o.redactPatterns) > 0 {
+		line = o.redactText(line)
+	}
+	return line
+}
+
+// lookupEncoding resolves an --encoding name such as latin1, utf16le or
+// shift_jis. It returns nil for UTF-8, which needs no transcoding.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	lower := strings.ToLower(name)
+	// Accept the common dashless spellings, as iconv does
+	if strings.HasPrefix(lower, "utf") && !strings.HasPrefix(lower, "utf-") {
+		lower = "utf-" + lower[3:]
+	}
+	if lower == "" || lower == "utf-8" {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(lower)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unknown encoding '%s'", name)
+	}
+	return enc, nil
+}
+
+// inputReader wraps r to transcode the --encoding to UTF-8.
+func (o *options) inputReader(r io.Reader) io.Reader {
+	if o.inputEncoding == nil {
+		return r
+	}
+	return transform.NewReader(r, o.inputEncoding.NewDecoder())
+}
+
+// bom is the byte order mark some Windows tools write at the start of files.
+const bom = "\uFEFF"
+
+// maxRecordSize bounds a single record, so a --delimiter that never matches
+// can't buffer the whole input.
+const maxRecordSize = 16 << 20
+
+// recordScanner reads the input records to highlight: lines by default,
+// NUL-terminated records with -0, or records split by --delimiter.
+type recordScanner struct {
+	*bufio.Scanner
+	sep      []byte
+	sepRe    *regexp.Regexp // set for /regex/ delimiters
+	delim    string         // delimiter that ended the current record
+	keepCRLF bool
+	keepCR   bool // leave the \r in records, for -A to show
+	started  bool
+	offset   int64 // where the current record starts in the input
+	next     int64 // where the next record starts
+}
+
+// newRecordScanner returns a scanner for the records in r.
+func (o *options) newRecordScanner(r io.Reader) *recordScanner {
+	s := &recordScanner{
+		Scanner:  bufio.NewScanner(o.inputReader(r)),
+		sep:      []byte("\n"),
+		sepRe:    o.delimiterRe,
+		keepCRLF: o.keepCRLF,
+		keepCR:   o.showAll,
+	}
+	switch {
+	case o.nullData:
+		s.sep = []byte{0}
+	case o.delimiter != "" && s.sepRe == nil:
+		s.sep = []byte(o.delimiter)
+	}
+	s.Buffer(nil, maxRecordSize)
+	s.Split(s.split)
+	return s
+}
+
+func (s *recordScanner) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = s.splitRecord(data, atEOF)
+	if advance > 0 {
+		s.offset = s.next
+		s.next += int64(advance)
+	}
+	return advance, token, err
+}
+
+func (s *recordScanner) splitRecord(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if s.sepRe != nil {
+		// Wait for more data if the match reaches the end of the buffer, as
+		// it might continue, as with /\n\n+/
+		if m := s.sepRe.FindIndex(data); m != nil && m[1] > m[0] && (m[1] < len(data) || atEOF) {
+			s.delim = string(data[m[0]:m[1]])
+			return m[1], data[:m[0]], nil
+		}
+	} else if i := bytes.Index(data, s.sep); i >= 0 {
+		s.delim = string(s.sep)
+		return i + len(s.sep), data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		s.delim = ""
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Offset returns where the current record starts in the input, in bytes after
+// decompression and --encoding.
+func (s *recordScanner) Offset() int64 {
+	return s.offset
+}
+
+// parseDelimiter compiles a /regex/ --delimiter. It returns nil for plain
+// string delimiters.
+func parseDelimiter(delim string) (*regexp.Regexp, error) {
+	if !isRegexRule(delim) || !strings.HasSuffix(delim, "/") {
+		return nil, nil
+	}
+	re, err := regexp.Compile(delim[1 : len(delim)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid --delimiter regex '%s': %v", delim, err)
+	}
+	return re, nil
+}
+
+// Record returns the current record and the terminator to write after it:
+// the delimiter as it appeared in the input. A byte order mark at the start of
+// the input is dropped, as is the \r of CRLF line endings unless --keep-crlf
+// is set; a trailing \r would otherwise defeat $ in regex rules and carry over
+// into highlights at the end of the line.
+func (s *recordScanner) Record() (record, end string) {
+	record = s.Text()
+	if !s.started {
+		record = strings.TrimPrefix(record, bom)
+		s.started = true
+	}
+	end = s.delim
+	if end == "" {
+		// The last record had no delimiter; terminate it anyway
+		end = string(s.sep)
+		if s.sepRe != nil {
+			end = "\n"
+		}
+	}
+	if s.sepRe == nil && string(s.sep) == "\n" && !s.keepCR {
+		var crlf bool
+		if record, crlf = strings.CutSuffix(record, "\r"); crlf && s.keepCRLF {
+			end = "\r\n"
+		}
+	}
+	return record, end
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalFlag is a flag that takes an optional systemd unit, as in --journal
+// or --journal=nginx.service. Without a unit it means the whole journal.
+type journalFlag struct {
+	set  bool
+	unit string
+}
+
+func (f *journalFlag) String() string { return f.unit }
+
+func (f *journalFlag) Set(value string) error {
+	f.set, f.unit = value != "false", ""
+	if value != "true" && value != "false" {
+		f.unit = value
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f *journalFlag) IsBoolFlag() bool { return true }
+
+// readJournal follows the systemd journal with journalctl and sends each
+// entry as a record, starting with the last --tail entries.
+func (o *options) readJournal(out chan<- record) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("--journal needs systemd's journalctl, which runs on Linux")
+	}
+	tail := o.tail
+	if tail == 0 {
+		tail = defaultFollowTail
+	}
+	args := []string{"--follow", "--output=json", "--lines=" + strconv.Itoa(tail)}
+	if o.journal.unit != "" {
+		args = append(args, "--unit="+o.journal.unit)
+	}
+	if o.priority != "" {
+		args = append(args, "--priority="+o.priority)
+	}
+	cmd := exec.Command("journalctl", args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("running journalctl: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), maxRecordSize)
+	for scanner.Scan() {
+		var entry map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		out <- record{text: formatJournalEntry(entry), end: "\n"}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("journalctl: %v", err)
+	}
+	return nil
+}
+
+// formatJournalEntry renders a journalctl JSON entry like a syslog line:
+// timestamp, host, priority name, unit, identifier and PID, then the message.
+// Keeping the metadata on the line lets rules match it, as in
+// /nginx\.service/ or err::red.
+func formatJournalEntry(entry map[string]any) string {
+	field := func(name string) string {
+		switch v := entry[name].(type) {
+		case string:
+			return v
+		case []any:
+			// Fields that aren't valid UTF-8 come as arrays of bytes
+			b := make([]byte, 0, len(v))
+			for _, c := range v {
+				if n, ok := c.(float64); ok {
+					b = append(b, byte(n))
+				}
+			}
+			return string(b)
+		}
+		return ""
+	}
+
+	var parts []string
+	if usec, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		parts = append(parts, time.UnixMicro(usec).Format(time.Stamp))
+	}
+	if host := field("_HOSTNAME"); host != "" {
+		parts = append(parts, host)
+	}
+	if p, err := strconv.Atoi(field("PRIORITY")); err == nil && p >= 0 && p < len(syslogSeverities) {
+		parts = append(parts, syslogSeverities[p])
+	}
+	if unit := field("_SYSTEMD_UNIT"); unit != "" {
+		parts = append(parts, unit)
+	}
+	tag := field("SYSLOG_IDENTIFIER")
+	if tag == "" {
+		tag = field("_COMM")
+	}
+	if pid := field("_PID"); pid != "" {
+		tag += "[" + pid + "]"
+	}
+	if tag != "" {
+		parts = append(parts, tag+":")
+	}
+	return strings.Join(append(parts, strings.TrimRight(field("MESSAGE"), "\n")), " ")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prettyJSONFlag is a flag that takes an optional indent, as in --pretty-json
+// or --pretty-json=2. Without an indent JSON stays on its line.
+type prettyJSONFlag struct {
+	set    bool
+	indent int // 0 to keep JSON on one line
+}
+
+func (f *prettyJSONFlag) String() string {
+	if f.indent > 0 {
+		return strconv.Itoa(f.indent)
+	}
+	return ""
+}
+
+func (f *prettyJSONFlag) Set(value string) error {
+	f.set, f.indent = value != "false", 0
+	if value == "true" || value == "false" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("want an indent width")
+	}
+	f.indent = n
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without an indent.
+func (f *prettyJSONFlag) IsBoolFlag() bool { return true }
+
+// prettyJSON reformats the JSON objects and arrays embedded in line, with a
+// space after colons and commas, or indented across lines with an indent. It
+// returns the new line and the syntax coloring of the JSON in it. Text that
+// isn't valid JSON is left as it is.
+func (o *options) prettyJSON(line string) (string, []span) {
+	if !strings.ContainsAny(line, "{[") {
+		return line, nil
+	}
+	var (
+		out    strings.Builder
+		syntax []span
+	)
+	last := 0
+	for i := 0; i < len(line); i++ {
+		if line[i] != '{' && line[i] != '[' {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(line[i:]))
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			continue
+		}
+		// Skip [] and {}, which are seldom JSON in a log line
+		end := i + int(dec.InputOffset())
+		if len(bytes.TrimSpace(raw)) <= 2 {
+			continue
+		}
+		var buf bytes.Buffer
+		if o.prettyJSONIndent.indent > 0 {
+			json.Indent(&buf, raw, "", strings.Repeat(" ", o.prettyJSONIndent.indent))
+		} else {
+			json.Compact(&buf, raw)
+		}
+		formatted := buf.Bytes()
+		if o.prettyJSONIndent.indent == 0 {
+			formatted = spaceJSON(formatted)
+		}
+		out.WriteString(line[last:i])
+		if o.prettyJSONIndent.indent > 0 && i > 0 {
+			// Start the document on its own line, so its indents line up
+			out.WriteString("\n")
+		}
+		syntax = append(syntax, jsonSyntax(string(formatted), out.Len(), o.syntaxColors)...)
+		out.Write(formatted)
+		last, i = end, end-1
+	}
+	if last == 0 {
+		return line, nil
+	}
+	out.WriteString(line[last:])
+	return out.String(), syntax
+}
+
+// spaceJSON adds a space after the colons and commas of compact JSON.
+func spaceJSON(compact []byte) []byte {
+	var b bytes.Buffer
+	inString := false
+	for i := 0; i < len(compact); i++ {
+		c := compact[i]
+		b.WriteByte(c)
+		switch {
+		case inString && c == '\\':
+			i++
+			b.WriteByte(compact[i])
+		case c == '"':
+			inString = !inString
+		case !inString && (c == ':' || c == ','):
+			b.WriteByte(' ')
+		}
+	}
+	return b.Bytes()
+}
+
+// jsonSyntax returns the syntax coloring of valid JSON text that starts at
+// offset in its line.
+func jsonSyntax(text string, offset int, colors syntaxColors) []span {
+	var spans []span
+	add := func(start, end int, color string) {
+		spans = append(spans, span{start: offset + start, end: offset + end, color: color})
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			color := colors.str
+			if rest := strings.TrimLeft(text[end:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				color = colors.key
+			}
+			add(i, end, color)
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(text) && strings.IndexByte("0123456789.eE+-", text[end]) >= 0 {
+				end++
+			}
+			add(i, end, colors.number)
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(text) && text[end] >= 'a' && text[end] <= 'z' {
+				end++
+			}
+			add(i, end, colors.literal)
+			i = end
+		case strings.IndexByte("{}[]:,", c) >= 0:
+			add(i, i+1, colors.punct)
+			i++
+		default:
+			i++
+		}
+	}
+	return spans
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// kubectlArgs returns kubectl arguments for the namespace and context given
+// to `ch kube`.
+func (o *options) kubectlArgs(args ...string) []string {
+	if o.kubeNamespace != "" {
+		args = append(args, "--namespace="+o.kubeNamespace)
+	}
+	if o.kubeContext != "" {
+		args = append(args, "--context="+o.kubeContext)
+	}
+	return args
+}
+
+// listPods returns the names of the pods matching the -l label selector.
+func (o *options) listPods() ([]string, error) {
+	cmd := exec.Command("kubectl", o.kubectlArgs("get", "pods", "--selector="+o.kubeSelector, "--output=name")...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing pods with kubectl: %v", err)
+	}
+	var pods []string
+	for _, line := range strings.Fields(string(output)) {
+		pods = append(pods, strings.TrimPrefix(line, "pod/"))
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pods match '%s'", o.kubeSelector)
+	}
+	return pods, nil
+}
+
+// readPods follows the logs of every pod listed by listPods with kubectl,
+// each record tagged with its pod's name, starting with the last --tail lines
+// of each. All containers are shown unless --container picks one.
+func (o *options) readPods(out chan<- record) error {
+	tail := o.tail
+	if tail == 0 {
+		tail = defaultFollowTail
+	}
+	return followAll(o.pods, func(pod string) error {
+		args := []string{"logs", "pod/" + pod, "--follow", "--tail=" + strconv.Itoa(tail)}
+		if o.kubeContainer != "" {
+			args = append(args, "--container="+o.kubeContainer)
+		} else {
+			args = append(args, "--all-containers")
+		}
+		return o.readCommand(exec.Command("kubectl", o.kubectlArgs(args...)...), pod, out)
+	})
+}
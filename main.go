@@ -1,84 +1,328 @@
 package main
 
 import (
-	"bufio"
-	"flag"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-// ANSI color codes
-const (
-	Reset = "\033[0m"
-)
+// groupColor assigns a color to one capture group of a regex rule.
+type groupColor struct {
+	index int
+	color string
+}
 
-type namedColor struct {
-	name string
-	r, g, b int
+type wordConfig struct {
+	original      string
+	search        string         // literal text to match
+	fold          *regexp.Regexp // matches search with Unicode case folding, for case-insensitive literal rules
+	caseSensitive bool
+	strictWord    bool           // only whole-word matches count, as with -W
+	max           int            // stop highlighting after this many matches, if set
+	icon          string         // shown with each highlight, from icon=X
+	iconSet       bool           // icon was given, even as "" to show none
+	ifMatch       *wordConfig    // only highlight lines this matches too, from if=PATTERN
+	unless        []wordConfig   // never highlight lines these match, from unless=PATTERN
+	until         *wordConfig    // closes the block a match opens, from until=PATTERN
+	inBlock       *bool          // a match opened a block that until hasn't closed yet
+	count         *int           // matches highlighted so far, shared between copies
+	re            *regexp.Regexp // set for /regex/ rules
+	group         int            // capture group to color for regex rules (0 = whole match)
+	groups        []groupColor   // per-group colors for /regex/::name=color,... rules
+	color         string
+	effect        *colorEffect // set for rainbow and gradient colors
+	background    bool
 }
 
-// Preset colors in order of assignment
-var namedColors = []namedColor{
-	{"red", 255, 105, 97},
-	{"green", 134, 194, 29},
-	{"orange", 240, 160, 75},
-	{"blue", 134, 176, 189},
-	{"pink", 255, 164, 164},
-	{"purple", 203, 166, 247},
+// ruleSep separates a rule's pattern from its color.
+const ruleSep = "::"
+
+// splitRule splits a rule on sep. A separator preceded by a backslash is part
+// of the pattern, so C++ and Rust paths can be matched, as in std\::io::orange.
+func splitRule(rule, sep string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(rule); {
+		switch {
+		case strings.HasPrefix(rule[i:], `\`+sep):
+			part.WriteString(sep)
+			i += 1 + len(sep)
+		case strings.HasPrefix(rule[i:], sep):
+			parts = append(parts, part.String())
+			part.Reset()
+			i += len(sep)
+		default:
+			part.WriteByte(rule[i])
+			i++
+		}
+	}
+	return append(parts, part.String())
 }
 
-func rgbToANSI(r, g, b int, background bool) string {
-	if background {
-		return fmt.Sprintf("\033[48;2;%d;%d;%dm", r, g, b)
+// normalizeRule rewrites a rule written with a custom separator to use
+// ruleSep, escaping any ruleSep within its parts.
+func normalizeRule(rule, sep string) string {
+	if sep == ruleSep {
+		return rule
+	}
+	parts := splitRule(rule, sep)
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, ruleSep, `\`+ruleSep)
 	}
-	return fmt.Sprintf("\033[38;2;%d;%d;%dm", r, g, b)
+	return strings.Join(parts, ruleSep)
 }
 
-type wordConfig struct {
-	original string
-	search   string // lowercase version for case-insensitive search
-	color    string
-	background bool
+// regexRuleEnd matches the end of a /regex/ rule: the closing slash and an
+// optional capture group selector, as in /$1, /$name or /${name}.
+var regexRuleEnd = regexp.MustCompile(`/(\$(\w+|\{\w+\}))?$`)
+
+// isRegexRule reports whether word uses the /regex/ rule syntax, optionally
+// followed by a capture group selector such as /user=(\w+)/$1. Other words
+// starting with a slash, like /api/users, are paths matched literally.
+func isRegexRule(word string) bool {
+	return len(word) >= 2 && word[0] == '/' && strings.LastIndex(word, "/") > 0 && regexRuleEnd.MatchString(word)
+}
+
+// compileRegex compiles the /regex/ pattern in cfg.original and resolves the
+// optional $N or $name capture group suffix.
+func (cfg *wordConfig) compileRegex(caseSensitive bool) error {
+	end := strings.LastIndex(cfg.original, "/")
+	expr := cfg.original[1:end]
+	groupRef := cfg.original[end+1:]
+
+	if !caseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid regex '%s': %v", cfg.original, err)
+	}
+	cfg.re = re
+
+	if groupRef == "" {
+		return nil
+	}
+	name := strings.Trim(groupRef[1:], "{}")
+	if n, err := strconv.Atoi(name); err == nil {
+		cfg.group = n
+	} else {
+		cfg.group = re.SubexpIndex(name)
+	}
+	if cfg.group <= 0 || cfg.group > re.NumSubexp() {
+		return fmt.Errorf("capture group '%s' does not exist in '%s'", groupRef, cfg.original)
+	}
+	return nil
+}
+
+// compile prepares cfg to match its pattern as a regex, or as literal text
+// ignoring case unless cs is set.
+func (cfg *wordConfig) compile(regex, cs bool) error {
+	if regex {
+		return cfg.compileRegex(cs)
+	}
+	if !cs && cfg.search != "" {
+		// Lowercasing both sides misses folds such as K/k (Kelvin) and
+		// can change byte lengths, throwing match offsets off
+		cfg.fold = regexp.MustCompile("(?i)" + regexp.QuoteMeta(cfg.search))
+	}
+	return nil
+}
+
+// condition compiles the pattern of an if=, unless= or until= modifier, matched with
+// the case sensitivity of its rule.
+func condition(pattern string, cs, fixedStrings bool) (wordConfig, error) {
+	cond := wordConfig{original: pattern, search: pattern}
+	err := cond.compile(!fixedStrings && isRegexRule(pattern), cs)
+	return cond, err
 }
 
-func parseColor(colorStr string, background bool) string {
-	// Check if it's a named color
-	lowerColor := strings.ToLower(colorStr)
-	for _, nc := range namedColors {
-		if nc.name == lowerColor {
-			return rgbToANSI(nc.r, nc.g, nc.b, background)
+// hasUppercase reports whether a rule's pattern contains an uppercase letter,
+// for smart case. In regex rules only literal characters count, so escapes
+// such as \W or \p{Lu} don't make a pattern case-sensitive.
+func hasUppercase(word string, regex bool) bool {
+	if !regex {
+		return strings.IndexFunc(word, unicode.IsUpper) >= 0
+	}
+	re, err := syntax.Parse(word[1:strings.LastIndex(word, "/")], syntax.Perl)
+	if err != nil {
+		return false // compileRegex reports the error
+	}
+	var walk func(re *syntax.Regexp) bool
+	walk = func(re *syntax.Regexp) bool {
+		if re.Op == syntax.OpLiteral {
+			for _, r := range re.Rune {
+				if unicode.IsUpper(r) {
+					return true
+				}
+			}
+		}
+		for _, sub := range re.Sub {
+			if walk(sub) {
+				return true
+			}
 		}
+		return false
 	}
+	return walk(re)
+}
 
-	// Otherwise treat as hex color
-	hex := strings.TrimPrefix(colorStr, "#")
+// isGroupColorSpec reports whether spec maps capture groups to colors, as in
+// level=red,latency=orange.
+func isGroupColorSpec(spec string) bool {
+	return strings.Contains(spec, "=")
+}
 
-	if len(hex) != 6 {
-		return ""
+// splitGroupColorSpec splits a group color spec on the commas between
+// entries, leaving commas inside rgb(...) and hsl(...) intact.
+func splitGroupColorSpec(spec string) []string {
+	var entries []string
+	depth, start := 0, 0
+	for i, ch := range spec {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				entries = append(entries, spec[start:i])
+				start = i + 1
+			}
+		}
 	}
+	return append(entries, spec[start:])
+}
 
-	var r, g, b int
-	fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b)
-	return rgbToANSI(r, g, b, background)
+// reserveColor marks color as used if it matches one of our presets.
+func reserveColor(color string, usedColors map[int]bool, background bool) {
+	for i, nc := range palette {
+		if color == rgbToANSI(nc.r, nc.g, nc.b, background) {
+			usedColors[i] = true
+			break
+		}
+	}
+}
+
+// parseGroupColors resolves a name=color,... spec against the capture groups
+// of the rule's regex. Groups may be referenced by name or by number.
+func (cfg *wordConfig) parseGroupColors(spec string, usedColors map[int]bool, background bool) error {
+	for _, entry := range splitGroupColorSpec(spec) {
+		name, colorStr, _ := strings.Cut(entry, "=")
+		idx, err := strconv.Atoi(name)
+		if err != nil {
+			idx = cfg.re.SubexpIndex(name)
+		}
+		if idx <= 0 || idx > cfg.re.NumSubexp() {
+			return fmt.Errorf("capture group '%s' does not exist in '%s'", name, cfg.original)
+		}
+
+		color, err := parseColor(colorStr, background)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: invalid color '%s' for group '%s' (%v), using preset\n", colorStr, name, err)
+			color = getNextAvailableColor(usedColors, background)
+		}
+		cfg.groups = append(cfg.groups, groupColor{idx, color})
+	}
+	return nil
 }
 
-func parseArgs(args []string, caseSensitive bool, background bool) []wordConfig {
+// ruleModifiers are the options a rule sets for itself after its color, as
+// in Error::red::cs.
+type ruleModifiers struct {
+	caseSensitive bool   // cs
+	ignoreCase    bool   // ci
+	strictWord    bool   // w
+	max           int    // max=N
+	icon          string // icon=X
+	iconSet       bool
+	ifMatch       string   // if=PATTERN
+	unless        []string // unless=PATTERN, repeatable
+	until         string   // until=PATTERN
+}
+
+// parseModifiers parses the modifiers of rule.
+func parseModifiers(rule string, mods []string) (ruleModifiers, error) {
+	var m ruleModifiers
+	for _, mod := range mods {
+		switch {
+		case mod == "cs":
+			m.caseSensitive = true
+		case mod == "ci":
+			m.ignoreCase = true
+		case mod == "w":
+			m.strictWord = true
+		case strings.HasPrefix(mod, "if="):
+			m.ifMatch = mod[len("if="):]
+			if m.ifMatch == "" {
+				return m, fmt.Errorf("invalid modifier '%s' in '%s' (if needs a pattern)", mod, rule)
+			}
+		case strings.HasPrefix(mod, "unless="):
+			if mod == "unless=" {
+				return m, fmt.Errorf("invalid modifier '%s' in '%s' (unless needs a pattern)", mod, rule)
+			}
+			m.unless = append(m.unless, mod[len("unless="):])
+		case strings.HasPrefix(mod, "until="):
+			m.until = mod[len("until="):]
+			if m.until == "" {
+				return m, fmt.Errorf("invalid modifier '%s' in '%s' (until needs a pattern)", mod, rule)
+			}
+		case strings.HasPrefix(mod, "icon="):
+			m.icon, m.iconSet = mod[len("icon="):], true
+		case strings.HasPrefix(mod, "max="):
+			n, err := strconv.Atoi(mod[len("max="):])
+			if err != nil || n < 1 {
+				return m, fmt.Errorf("invalid modifier '%s' in '%s' (max needs a positive count)", mod, rule)
+			}
+			m.max = n
+		default:
+			return m, fmt.Errorf("unknown modifier '%s' in '%s' (write a literal :: in a pattern as \\::)", mod, rule)
+		}
+	}
+	if m.caseSensitive && m.ignoreCase {
+		return m, fmt.Errorf("modifiers 'cs' and 'ci' conflict in '%s'", rule)
+	}
+	return m, nil
+}
+
+// parseOptions control how rules are parsed.
+type parseOptions struct {
+	caseSensitive bool
+	background    bool
+	fixedStrings  bool // treat /regex/ rules as literal text
+	smartCase     bool // match case-sensitively only rules with uppercase letters
+}
+
+func parseArgs(args []string, opts parseOptions) ([]wordConfig, error) {
+	caseSensitive, background := opts.caseSensitive, opts.background
 	var configs []wordConfig
-	usedColors := make(map[int]bool) // track indices in namedColors
+	usedColors := make(map[int]bool) // track indices in palette
 
 	// First pass: reserve colors that are explicitly specified
 	for _, arg := range args {
-		parts := strings.Split(arg, "::")
-		if len(parts) == 2 && parts[1] != "" {
-			color := parseColor(parts[1], background)
-			if color != "" {
-				// Mark named color as used if it matches one of our presets
-				for i, nc := range namedColors {
-					if color == rgbToANSI(nc.r, nc.g, nc.b, background) {
-						usedColors[i] = true
-						break
-					}
+		parts := splitRule(arg, ruleSep)
+		if len(parts) >= 2 && parts[1] != "" {
+			specs := []string{parts[1]}
+			if isGroupColorSpec(parts[1]) {
+				specs = nil
+				for _, entry := range splitGroupColorSpec(parts[1]) {
+					_, colorStr, _ := strings.Cut(entry, "=")
+					specs = append(specs, colorStr)
+				}
+			}
+			for _, spec := range specs {
+				if color, err := parseColor(spec, background); err == nil {
+					reserveColor(color, usedColors, background)
 				}
 			}
 		}
@@ -86,137 +330,352 @@ func parseArgs(args []string, caseSensitive bool, background bool) []wordConfig
 
 	// Second pass: assign colors
 	for _, arg := range args {
-		parts := strings.Split(arg, "::")
+		parts := splitRule(arg, ruleSep)
 		word := parts[0]
+		var mods ruleModifiers
+		if len(parts) > 2 {
+			var err error
+			if mods, err = parseModifiers(arg, parts[2:]); err != nil {
+				return nil, err
+			}
+		}
 
-		var color string
-		if len(parts) == 2 && parts[1] != "" {
-			// Custom color specified (either named or hex)
-			color = parseColor(parts[1], background)
-			if color == "" {
-				fmt.Fprintf(os.Stderr, "Warning: invalid color '%s' for word '%s', using preset\n", parts[1], word)
-				color = getNextAvailableColor(usedColors, background)
+		regex := !opts.fixedStrings && isRegexRule(word)
+		cs := caseSensitive || opts.smartCase && hasUppercase(word, regex)
+		switch {
+		case mods.caseSensitive:
+			cs = true
+		case mods.ignoreCase:
+			cs = false
+		}
+
+		cfg := wordConfig{
+			original:      word,
+			search:        word,
+			caseSensitive: cs,
+			strictWord:    mods.strictWord,
+			max:           mods.max,
+			icon:          mods.icon,
+			iconSet:       mods.iconSet,
+			count:         new(int),
+			background:    background,
+		}
+		if err := cfg.compile(regex, cs); err != nil {
+			return nil, err
+		}
+		if mods.ifMatch != "" {
+			cond, err := condition(mods.ifMatch, cs, opts.fixedStrings)
+			if err != nil {
+				return nil, err
+			}
+			cfg.ifMatch = &cond
+		}
+		for _, pattern := range mods.unless {
+			cond, err := condition(pattern, cs, opts.fixedStrings)
+			if err != nil {
+				return nil, err
+			}
+			cfg.unless = append(cfg.unless, cond)
+		}
+		if mods.until != "" {
+			cond, err := condition(mods.until, cs, opts.fixedStrings)
+			if err != nil {
+				return nil, err
+			}
+			cfg.until, cfg.inBlock = &cond, new(bool)
+		}
+
+		if len(parts) >= 2 && parts[1] != "" {
+			if cfg.re != nil && isGroupColorSpec(parts[1]) {
+				// Per-group colors for a single-pass multi-group regex
+				if err := cfg.parseGroupColors(parts[1], usedColors, background); err != nil {
+					return nil, err
+				}
+			} else if effect := parseColorEffect(parts[1], background); effect != nil {
+				cfg.effect = effect
+			} else {
+				// Custom color specified (either named or hex)
+				color, err := parseColor(parts[1], background)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: invalid color '%s' for word '%s' (%v), using preset\n", parts[1], word, err)
+					color = getNextAvailableColor(usedColors, background)
+				}
+				cfg.color = color
 			}
 		} else {
 			// Use next available preset color
-			color = getNextAvailableColor(usedColors, background)
+			cfg.color = getNextAvailableColor(usedColors, background)
 		}
 
-		search := word
-		if !caseSensitive {
-			search = strings.ToLower(word)
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+// span is a colored [start, end) byte range within a line.
+type span struct {
+	start  int
+	end    int
+	color  string
+	effect *colorEffect
+}
+
+// render wraps text in the span's color.
+func (m span) render(text string) string {
+	if m.effect != nil {
+		return m.effect.paint(text)
+	}
+	return m.color + text + Reset
+}
+
+// findMatches returns every match of cfg in line along with the color to
+// apply.
+func findMatches(line string, cfg wordConfig) []span {
+	var matches []span
+
+	if cfg.re != nil {
+		for _, m := range cfg.re.FindAllStringSubmatchIndex(line, -1) {
+			if cfg.groups != nil {
+				for _, g := range cfg.groups {
+					if start, end := m[2*g.index], m[2*g.index+1]; start >= 0 && start < end {
+						matches = append(matches, span{start: start, end: end, color: g.color})
+					}
+				}
+				continue
+			}
+
+			start, end := m[2*cfg.group], m[2*cfg.group+1]
+			// Skip matches where the selected group did not participate
+			if start < 0 || start == end {
+				continue
+			}
+			matches = append(matches, span{start, end, cfg.color, cfg.effect})
+		}
+		return matches
+	}
+
+	if cfg.fold != nil {
+		for _, m := range cfg.fold.FindAllStringIndex(line, -1) {
+			matches = append(matches, span{m[0], m[1], cfg.color, cfg.effect})
 		}
+		return matches
+	}
 
-		configs = append(configs, wordConfig{
-			original: word,
-			search:   search,
-			color:    color,
-			background: background,
-		})
+	if cfg.search == "" {
+		return nil
+	}
+	pos := 0
+	for {
+		idx := strings.Index(line[pos:], cfg.search)
+		if idx == -1 {
+			break
+		}
+		idx += pos
+		matches = append(matches, span{idx, idx + len(cfg.search), cfg.color, cfg.effect})
+		pos = idx + 1
 	}
+	return matches
+}
 
-	return configs
+// isWordRune reports whether r is part of a word: a letter, number, combining
+// mark, connector punctuation such as _, or one of the extra characters.
+func isWordRune(r rune, extra string) bool {
+	return unicode.In(r, unicode.L, unicode.N, unicode.M, unicode.Pc) || strings.ContainsRune(extra, r)
 }
 
-func getNextAvailableColor(usedColors map[int]bool, background bool) string {
-	// Find first unused color from namedColors slice
-	for i, nc := range namedColors {
-		if !usedColors[i] {
-			usedColors[i] = true
-			return rgbToANSI(nc.r, nc.g, nc.b, background)
+// extendToWord widens the [start, end) byte range of a match over the word
+// characters around it, counting the extra characters as word characters.
+func extendToWord(line string, start, end int, extra string) (int, int) {
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isWordRune(r, extra) {
+			break
 		}
+		start -= size
 	}
+	for end < len(line) {
+		r, size := utf8.DecodeRuneInString(line[end:])
+		if !isWordRune(r, extra) {
+			break
+		}
+		end += size
+	}
+	return start, end
+}
 
-	// If all colors used, cycle back to the beginning
-	return rgbToANSI(namedColors[0].r, namedColors[0].g, namedColors[0].b, background)
+// onWordBoundaries reports whether the [start, end) byte range of a match is
+// not preceded or followed by a word character.
+func onWordBoundaries(line string, start, end int, extra string) bool {
+	if r, _ := utf8.DecodeLastRuneInString(line[:start]); start > 0 && isWordRune(r, extra) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(line[end:]); end < len(line) && isWordRune(r, extra) {
+		return false
+	}
+	return true
 }
 
-func highlightLine(line string, configs []wordConfig, caseSensitive, wholeWord bool) string {
-	if len(configs) == 0 {
-		return line
+// highlightOptions controls how rules are matched and applied to a line.
+type highlightOptions struct {
+	wholeWord  bool
+	strictWord bool   // only keep matches that are whole words, like grep -w
+	wordChars  string // extra characters counted as part of a word
+	showAll    bool   // draw invisible characters as symbols
+	focus      bool   // dim the text outside highlights
+	invert     bool   // dim the matches instead of coloring them
+	tint       string // color of the text outside highlights, from --tint
+	icons      iconsFlag
+	syntax     []span // colors of the text outside highlights, by position, as from --pretty-json
+	guides     []int  // positions of --indent-guides, in order
+	explain    *explainer
+}
+
+// text returns line[start:end] for output, with invisible characters drawn
+// as symbols if requested. Outside highlights, symbols are dimmed, or with
+// --focus all of the text, and the text is syntax colored or tinted with
+// --tint.
+func (opts highlightOptions) text(line string, start, end int, highlighted bool) string {
+	if !highlighted && len(opts.guides) > 0 && opts.guides[0] < end && opts.guides[len(opts.guides)-1] >= start {
+		return opts.guideText(line, start, end)
+	}
+	if !highlighted && !opts.focus && len(opts.syntax) > 0 {
+		return opts.syntaxText(line, start, end)
 	}
+	text := line[start:end]
+	if opts.showAll {
+		text = showNonPrinting(line, start, end, !highlighted && !opts.focus)
+	}
+	switch {
+	case highlighted || text == "":
+	case opts.focus:
+		return dimColor + text + Reset
+	case opts.tint != "":
+		// Resume the tint after dimmed symbols
+		return opts.tint + strings.ReplaceAll(text, Reset, Reset+opts.tint) + Reset
+	}
+	return text
+}
 
-	searchLine := line
-	if !caseSensitive {
-		searchLine = strings.ToLower(line)
+// skips returns why the rule's if= or unless= modifiers rule out line, or ""
+// if they don't.
+func (cfg wordConfig) skips(line string) string {
+	if cfg.ifMatch != nil && len(findMatches(line, *cfg.ifMatch)) == 0 {
+		return "line doesn't match if=" + cfg.ifMatch.original
+	}
+	if i := slices.IndexFunc(cfg.unless, func(cond wordConfig) bool { return len(findMatches(line, cond)) > 0 }); i >= 0 {
+		return "line matches unless=" + cfg.unless[i].original
 	}
+	return ""
+}
 
-	// Track which positions are already colored (to handle overlapping matches)
-	colored := make([]bool, len(line))
+// replacement is a highlighted [start, end) byte range of a line and its
+// colored text.
+type replacement struct {
+	start int
+	end   int
+	text  string
+}
 
-	// Store replacements as [start, end, replacement]
-	type replacement struct {
-		start int
-		end   int
-		text  string
+// findReplacements returns the highlights of line in order of position.
+func findReplacements(line string, configs []wordConfig, opts highlightOptions) []replacement {
+	opts.explain.nextLine(line)
+	if len(configs) == 0 {
+		return nil
 	}
+
+	// Track which rule colored each position (to handle overlapping matches);
+	// 0 means uncolored, otherwise the rule index plus one
+	colored := make([]int, len(line))
+	bounds := newGraphemeBounds(line)
+
 	var replacements []replacement
 
 	// Find all matches
-	for _, cfg := range configs {
-		pos := 0
-		for {
-			idx := strings.Index(searchLine[pos:], cfg.search)
-			if idx == -1 {
-				break
+	for ruleIdx, cfg := range configs {
+		if reason := cfg.skips(line); reason != "" {
+			opts.explain.logf("rule %d %q: skipped, %s", ruleIdx+1, cfg.original, reason)
+			continue
+		}
+		matches := findMatches(line, cfg)
+		if len(matches) == 0 {
+			opts.explain.logf("rule %d %q: no match", ruleIdx+1, cfg.original)
+		}
+		for _, m := range matches {
+			startIdx, endIdx := m.start, m.end
+			opts.explain.logf("rule %d %q: matched %q at [%d,%d)", ruleIdx+1, cfg.original, line[startIdx:endIdx], startIdx, endIdx)
+
+			// Never split a character from its combining marks
+			startIdx, endIdx = bounds.snap(startIdx, endIdx)
+			if startIdx != m.start || endIdx != m.end {
+				opts.explain.logf("rule %d %q: widened to whole characters %q at [%d,%d)", ruleIdx+1, cfg.original, line[startIdx:endIdx], startIdx, endIdx)
 			}
-			idx += pos
 
-			startIdx := idx
-			endIdx := idx + len(cfg.search)
+			// In strict mode, drop matches inside a larger word
+			if (opts.strictWord || cfg.strictWord) && !onWordBoundaries(line, startIdx, endIdx, opts.wordChars) {
+				opts.explain.logf("rule %d %q: discarded [%d,%d), not a whole word", ruleIdx+1, cfg.original, startIdx, endIdx)
+				continue
+			}
 
 			// If wholeWord mode, extend to word boundaries
-			if wholeWord {
-				// Extend backwards to start of word
-				for startIdx > 0 && line[startIdx-1] != ' ' && line[startIdx-1] != '\n' && line[startIdx-1] != '\t' {
-					startIdx--
-				}
-				// Extend forwards to end of word
-				for endIdx < len(line) && line[endIdx] != ' ' && line[endIdx] != '\n' && line[endIdx] != '\t' {
-					endIdx++
+			if opts.wholeWord {
+				start, end := startIdx, endIdx
+				startIdx, endIdx = extendToWord(line, startIdx, endIdx, opts.wordChars)
+				if startIdx != start || endIdx != end {
+					opts.explain.logf("rule %d %q: extended to whole word %q at [%d,%d)", ruleIdx+1, cfg.original, line[startIdx:endIdx], startIdx, endIdx)
 				}
 			}
 
 			// Check if this position is already colored (overlapping match)
 			alreadyColored := false
 			for i := startIdx; i < endIdx; i++ {
-				if colored[i] {
+				if colored[i] != 0 {
 					alreadyColored = true
+					opts.explain.logf("rule %d %q: discarded [%d,%d), overlaps rule %d %q at offset %d",
+						ruleIdx+1, cfg.original, startIdx, endIdx, colored[i], configs[colored[i]-1].original, i)
 					break
 				}
 			}
 
+			if !alreadyColored && cfg.max > 0 && *cfg.count >= cfg.max {
+				opts.explain.logf("rule %d %q: discarded [%d,%d), reached max=%d", ruleIdx+1, cfg.original, startIdx, endIdx, cfg.max)
+				continue
+			}
+
 			if !alreadyColored {
+				if cfg.max > 0 {
+					*cfg.count++
+				}
+
 				// Mark as colored
 				for i := startIdx; i < endIdx; i++ {
-					colored[i] = true
+					colored[i] = ruleIdx + 1
 				}
+				opts.explain.logf("rule %d %q: highlighted [%d,%d)", ruleIdx+1, cfg.original, startIdx, endIdx)
 
 				// Store replacement
-				matchedText := line[startIdx:endIdx]
-				coloredText := cfg.color + matchedText + Reset
+				matchedText := opts.text(line, startIdx, endIdx, true)
+				coloredText := m.render(matchedText)
+				if opts.invert {
+					coloredText = dimColor + matchedText + Reset
+				}
+				if icon := opts.icon(cfg, line[startIdx:endIdx]); icon != "" {
+					if opts.icons.replace {
+						coloredText = icon
+					} else {
+						coloredText = icon + " " + coloredText
+					}
+				}
 				replacements = append(replacements, replacement{
 					start: startIdx,
 					end:   endIdx,
 					text:  coloredText,
 				})
 			}
-
-			pos = idx + 1
 		}
 	}
 
-	// If no matches, return original line
-	if len(replacements) == 0 {
-		return line
-	}
-
 	// Sort replacements by start position (they should already be mostly sorted)
-	// Build result string
-	var result strings.Builder
-	lastPos := 0
-
-	// Sort replacements by start position
 	for i := 0; i < len(replacements); i++ {
 		for j := i + 1; j < len(replacements); j++ {
 			if replacements[j].start < replacements[i].start {
@@ -224,50 +683,163 @@ func highlightLine(line string, configs []wordConfig, caseSensitive, wholeWord b
 			}
 		}
 	}
+	return replacements
+}
+
+// render writes line with its highlights applied.
+func (opts highlightOptions) render(line string, replacements []replacement) string {
+	// If no matches, return original line
+	if len(replacements) == 0 {
+		return opts.text(line, 0, len(line), false)
+	}
 
+	// Build result string
+	var result strings.Builder
+	lastPos := 0
 	for _, r := range replacements {
-		result.WriteString(line[lastPos:r.start])
+		result.WriteString(opts.text(line, lastPos, r.start, false))
 		result.WriteString(r.text)
 		lastPos = r.end
 	}
-	result.WriteString(line[lastPos:])
+	result.WriteString(opts.text(line, lastPos, len(line), false))
 
 	return result.String()
 }
 
-func main() {
-	caseSensitive := flag.Bool("s", false, "case-sensitive matching")
-	wholeWord := flag.Bool("w", false, "extend match to whole word (until space or EOL)")
-	background := flag.Bool("b", false, "use background colors instead of foreground")
-	flag.Parse()
-
-	args := flag.Args()
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Usage: ch [options] <word1> <word2>::<COLOR> ...\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		fmt.Fprintf(os.Stderr, "  -s    case-sensitive matching (default: case-insensitive)\n")
-		fmt.Fprintf(os.Stderr, "  -w    extend match to whole word\n")
-		fmt.Fprintf(os.Stderr, "  -b    use background colors instead of foreground\n")
-		fmt.Fprintf(os.Stderr, "\nColors:\n")
-		fmt.Fprintf(os.Stderr, "  Named: red, green, orange, blue, pink, purple\n")
-		fmt.Fprintf(os.Stderr, "  Hex: any 6-digit hex color (e.g., FF5500)\n")
-		fmt.Fprintf(os.Stderr, "\nExample:\n")
-		fmt.Fprintf(os.Stderr, "  tail -f app.log | ch error::red warning::orange success::green\n")
-		os.Exit(1)
+// runHighlight implements the default `ch run` command: it highlights rules
+// in stdin, or in the --test sample lines. While reading stdin, editing the
+// rule files or sending SIGHUP reloads them without interrupting the stream.
+func runHighlight(opts *options, args []string) error {
+	var explain *explainer
+	if opts.explain {
+		explain = &explainer{w: os.Stderr}
+	}
+	m, err := opts.newMatcher(args, explain)
+	if err != nil {
+		return err
+	}
+	// The matcher in use, swapped when the rules reload
+	var current atomic.Pointer[matcher]
+	current.Store(m)
+	defer func() {
+		opts.flushAligned()
+		opts.writeCounts(os.Stdout, current.Load())
+	}()
+
+	// Count lines for --head and highlighted lines for -m. Inputs that don't
+	// count their lines, like syslog, are numbered for -n and --byte-offset
+	// as they arrive, and stamped for --ts and --elapsed. Lines dropped by
+	// --hide keep their place in the numbering but don't count.
+	var lines, matched, unnumbered int
+	var unnumberedBytes int64
+	process := func(m *matcher, rec record) (done bool) {
+		if rec.eof {
+			return false
+		}
+		if rec.line == 0 {
+			unnumbered++
+			rec.line, rec.offset = unnumbered, unnumberedBytes
+			unnumberedBytes += int64(len(rec.text) + len(rec.end))
+		}
+		if opts.hidden(rec) {
+			return false
+		}
+		lines++
+		if opts.stampRecords() && rec.read.IsZero() {
+			rec.read = time.Now()
+		}
+		if opts.emit(m, rec) {
+			matched++
+		}
+		return opts.head > 0 && lines >= opts.head || opts.maxCount > 0 && matched >= opts.maxCount
 	}
 
-	configs := parseArgs(args, *caseSensitive, *background)
+	// Sample lines given with --test replace stdin
+	if len(opts.testLines) > 0 {
+		for _, line := range opts.testLines {
+			if process(m, record{text: line, end: "\n"}) {
+				break
+			}
+		}
+		return nil
+	}
+
+	// Reloads, from SIGHUP or from edited rule files, run one at a time, and
+	// each works on its own copy of the options as they were set up, so the
+	// options read while formatting never change under the main loop. Only
+	// the matcher built from the copy is published.
+	var reloading sync.Mutex
+	base := *opts
+	rebuild := func() (*matcher, error) {
+		reloading.Lock()
+		defer reloading.Unlock()
+		next := base
+		if err := next.reload(); err != nil {
+			return nil, err
+		}
+		return next.newMatcher(args, explain)
+	}
+	reloadOnHangup(&current, rebuild)
+	if err := reloadOnChange(&current, opts.ruleFiles(), rebuild); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: rule files won't reload on change: %v\n", err)
+	}
+
+	// Read from stdin or the files record by record
+	records, errc := opts.startInputs()
+	if opts.record != "" {
+		if records, err = recordSession(records, opts.record); err != nil {
+			return fmt.Errorf("recording session: %v", err)
+		}
+	}
+	if opts.merging() {
+		records = mergeByTime(records, opts.sources)
+	}
+	if opts.replay {
+		speed := float64(opts.speed)
+		if speed == 0 {
+			speed = 1
+		}
+		records = replay(records, speed)
+	}
+	// With --align, lines wait a moment to be aligned with the next ones
+	var timeout <-chan time.Time
+	for records != nil {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				records = nil
+				break
+			}
+			if process(current.Load(), rec) {
+				// Stop reading; exiting closes the pipe, so the writer
+				// upstream gets SIGPIPE, as with head or grep -m
+				return nil
+			}
+			if opts.align && timeout == nil {
+				timeout = time.After(alignDelay)
+			}
+		case <-timeout:
+			timeout = nil
+			opts.flushAligned()
+		}
+	}
 
-	// Read from stdin line by line
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := scanner.Text()
-		highlighted := highlightLine(line, configs, *caseSensitive, *wholeWord)
-		fmt.Println(highlighted)
+	if err := <-errc; err != nil {
+		return fmt.Errorf("reading input: %v", err)
 	}
+	return nil
+}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+func main() {
+	args := os.Args[1:]
+	// Installed as kubectl-ch, ch is the kubectl plugin `kubectl ch`
+	if strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == "kubectl-ch" {
+		args = append([]string{"kube"}, args...)
+	}
+	if err := execute(args); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"time"
+)
+
+// mergeDelay is how long --merge-by-time holds a record back in case an
+// earlier one is still coming from another source.
+const mergeDelay = 500 * time.Millisecond
+
+// timedRecord is a record waiting to be merged.
+type timedRecord struct {
+	record
+	time    time.Time
+	arrived time.Time
+}
+
+// merging reports whether --merge-by-time has sources to merge. Only then
+// do readers mark the end of each source.
+func (o *options) merging() bool {
+	return o.mergeByTime && len(o.sources) > 1
+}
+
+// mergeByTime reorders records from several sources by their timestamps.
+// Records are sent once every source still open has one waiting, so the
+// earliest can be picked, or once they have waited mergeDelay for a quiet
+// source. Records without a timestamp take their source's previous one, so
+// continuation lines like stack traces stay with their entry. Each source's
+// own order is kept.
+func mergeByTime(in <-chan record, sources []string) <-chan record {
+	out := make(chan record, 64)
+	go func() {
+		defer close(out)
+		queues := make(map[string][]timedRecord)
+		last := make(map[string]time.Time)
+		open := make(map[string]bool)
+		for _, source := range sources {
+			open[source] = true
+		}
+
+		// pop sends the earliest waiting record, and reports false if none is
+		pop := func() bool {
+			var first string
+			found := false
+			for source, queue := range queues {
+				if len(queue) == 0 {
+					continue
+				}
+				head := queue[0]
+				if !found || head.time.Before(queues[first][0].time) ||
+					head.time.Equal(queues[first][0].time) && head.arrived.Before(queues[first][0].arrived) {
+					first, found = source, true
+				}
+			}
+			if !found {
+				return false
+			}
+			out <- queues[first][0].record
+			queues[first] = queues[first][1:]
+			return true
+		}
+		// ready reports whether every open source has a record waiting
+		ready := func() bool {
+			for source := range open {
+				if len(queues[source]) == 0 {
+					return false
+				}
+			}
+			return true
+		}
+		// oldest returns when the longest-waiting record arrived
+		oldest := func() (time.Time, bool) {
+			var t time.Time
+			found := false
+			for _, queue := range queues {
+				if len(queue) > 0 && (!found || queue[0].arrived.Before(t)) {
+					t, found = queue[0].arrived, true
+				}
+			}
+			return t, found
+		}
+
+		for {
+			for {
+				arrived, waiting := oldest()
+				if !waiting || !ready() && time.Since(arrived) < mergeDelay {
+					break
+				}
+				pop()
+			}
+
+			var timeout <-chan time.Time
+			if arrived, waiting := oldest(); waiting {
+				timeout = time.After(time.Until(arrived.Add(mergeDelay)))
+			}
+			select {
+			case rec, ok := <-in:
+				if !ok {
+					for pop() {
+					}
+					return
+				}
+				if rec.eof {
+					delete(open, rec.source)
+					continue
+				}
+				t, ok := parseTimestamp(rec.text)
+				if ok {
+					last[rec.source] = t
+				} else {
+					t = last[rec.source]
+				}
+				queues[rec.source] = append(queues[rec.source], timedRecord{record: rec, time: t, arrived: time.Now()})
+			case <-timeout:
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,156 @@
+package main
+
+import "strings"
+
+// bracketHueStep is the hue, in degrees, between the colors of successive
+// --rainbow-brackets depths, far enough apart that neighbors stand out.
+const bracketHueStep = 100
+
+// unmatchedBracketColor marks closing brackets that close nothing, or the
+// wrong kind of bracket.
+var unmatchedBracketColor = rgbToANSI(255, 105, 97, false)
+
+// bracketPairs maps closing brackets to their opening ones.
+var bracketPairs = map[byte]byte{')': '(', ']': '[', '}': '{'}
+
+// nesting follows the structure of one source across its lines, for
+// --rainbow-brackets and --indent-guides.
+type nesting struct {
+	open    []byte // open brackets, innermost last
+	indents []int  // indents of the enclosing lines, innermost last
+}
+
+// bracketColor returns the --rainbow-brackets color of depth.
+func bracketColor(depth int) string {
+	r, g, b := hslToRGB(float64(45+depth*bracketHueStep), rainbowSaturation, rainbowLightness)
+	return rgbToANSI(r, g, b, false)
+}
+
+// nest returns the bracket colors and indentation guides of text, a record
+// of source. Pairs are tracked across records, so a bracket opened on one
+// line and closed on a later one gets the same color; brackets in double
+// quotes don't count. Guides are the byte positions of the spaces to draw a
+// guide on: the columns of the enclosing lines' indents.
+func (o *options) nest(source, text string) (brackets []span, guides []int) {
+	if o.nesting == nil {
+		o.nesting = make(map[string]*nesting)
+	}
+	n := o.nesting[source]
+	if n == nil {
+		n = &nesting{}
+		o.nesting[source] = n
+	}
+	for start := 0; start <= len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		line := text[start:end]
+		if o.indentGuides {
+			guides = append(guides, n.guides(line, start)...)
+		}
+		if o.rainbowBrackets {
+			brackets = append(brackets, n.brackets(line, start)...)
+		}
+		start = end + 1
+	}
+	return brackets, guides
+}
+
+// guides returns the guide positions of line, found at offset in its record.
+// Blank lines have none and leave the enclosing indents as they are.
+func (n *nesting) guides(line string, offset int) []int {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	if indent == len(line) {
+		return nil
+	}
+	for len(n.indents) > 0 && n.indents[len(n.indents)-1] >= indent {
+		n.indents = n.indents[:len(n.indents)-1]
+	}
+	var guides []int
+	for _, col := range n.indents {
+		if line[col] == ' ' {
+			guides = append(guides, offset+col)
+		}
+	}
+	n.indents = append(n.indents, indent)
+	return guides
+}
+
+// brackets returns the colors of the brackets in line, found at offset in its
+// record.
+func (n *nesting) brackets(line string, offset int) []span {
+	var spans []span
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '(' || c == '[' || c == '{':
+			spans = append(spans, span{start: offset + i, end: offset + i + 1, color: bracketColor(len(n.open))})
+			n.open = append(n.open, c)
+		case bracketPairs[c] != 0:
+			color := unmatchedBracketColor
+			if depth := len(n.open) - 1; depth >= 0 && n.open[depth] == bracketPairs[c] {
+				color = bracketColor(depth)
+				n.open = n.open[:depth]
+			}
+			spans = append(spans, span{start: offset + i, end: offset + i + 1, color: color})
+		}
+	}
+	return spans
+}
+
+// overlaySpans lays top over base, both in order of position, cutting the
+// base spans around the top ones.
+func overlaySpans(base, top []span) []span {
+	if len(top) == 0 {
+		return base
+	}
+	var spans []span
+	i := 0
+	for _, s := range base {
+		for s.start < s.end {
+			for i < len(top) && top[i].end <= s.start {
+				spans = append(spans, top[i])
+				i++
+			}
+			if i == len(top) || top[i].start >= s.end {
+				spans = append(spans, s)
+				break
+			}
+			if top[i].start > s.start {
+				before := s
+				before.end = top[i].start
+				spans = append(spans, before)
+			}
+			s.start = top[i].end
+		}
+	}
+	return append(spans, top[i:]...)
+}
+
+// guideText returns line[start:end] outside highlights with the indentation
+// guides in it drawn as faint bars.
+func (opts highlightOptions) guideText(line string, start, end int) string {
+	guides := opts.guides
+	opts.guides = nil
+	var b strings.Builder
+	pos := start
+	for _, g := range guides {
+		if g < start || g >= end {
+			continue
+		}
+		b.WriteString(opts.text(line, pos, g, false))
+		b.WriteString(dimColor + "│" + Reset)
+		pos = g + 1
+	}
+	b.WriteString(opts.text(line, pos, end, false))
+	return b.String()
+}
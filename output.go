@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/term"
+)
+
+// widthFlag is a flag that takes an optional column count, as in --truncate
+// or --truncate=100. Without a count it means the terminal width.
+type widthFlag struct {
+	set     bool
+	columns int // 0 for the terminal width
+}
+
+func (f *widthFlag) String() string {
+	if f.set && f.columns > 0 {
+		return strconv.Itoa(f.columns)
+	}
+	return ""
+}
+
+func (f *widthFlag) Set(value string) error {
+	f.set, f.columns = false, 0
+	if value == "true" {
+		f.set = true
+		return nil
+	}
+	if value == "false" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("want a column count")
+	}
+	f.set, f.columns = true, n
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f *widthFlag) IsBoolFlag() bool { return true }
+
+// width returns the column count, resolving the terminal width if none was
+// given. It falls back to $COLUMNS, then 80, when stdout isn't a terminal.
+func (f *widthFlag) width() int {
+	if f.columns > 0 {
+		return f.columns
+	}
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// ansiToken returns the escape sequence or grapheme cluster at the start of
+// s, and its width in columns.
+func ansiToken(s string, state int) (token string, width, newState int) {
+	if s[0] == 0x1b {
+		if loc := ansiEscape.FindStringIndex(s); loc != nil && loc[0] == 0 {
+			// The segmenter state looks ahead at the text that followed the
+			// previous cluster, which was this sequence; start afresh
+			return s[:loc[1]], 0, -1
+		}
+	}
+	token, _, width, newState = uniseg.FirstGraphemeClusterInString(s, state)
+	return token, width, newState
+}
+
+// truncateANSI cuts s to at most width columns, ending it with … when cut.
+// Escape sequences take no room, so the cut lands where it appears to, and a
+// reset is added so the color doesn't leak past the cut.
+func truncateANSI(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	col, state := 0, -1
+	for rest := s; rest != ""; {
+		var token string
+		var w int
+		token, w, state = ansiToken(rest, state)
+		rest = rest[len(token):]
+		if col+w > width-1 {
+			break
+		}
+		b.WriteString(token)
+		col += w
+	}
+	b.WriteString("…")
+	if strings.Contains(s, "\x1b") {
+		b.WriteString(Reset)
+	}
+	return b.String()
+}
+
+// wrapANSI breaks s into lines of at most width columns. The colors active at
+// each break are reset at the end of the line and re-emitted at the start of
+// the next, so every line renders correctly on its own.
+func wrapANSI(s string, width int) []string {
+	var lines []string
+	var b strings.Builder
+	var active string // SGR sequences in effect since the last reset
+	col, state := 0, -1
+	for rest := s; rest != ""; {
+		var token string
+		var w int
+		token, w, state = ansiToken(rest, state)
+		rest = rest[len(token):]
+
+		switch {
+		case token == Reset || token == "\x1b[m":
+			active = ""
+		case token[0] == 0x1b && strings.HasSuffix(token, "m"):
+			active += token
+		case col+w > width && col > 0:
+			if active != "" {
+				b.WriteString(Reset)
+			}
+			lines = append(lines, b.String())
+			b.Reset()
+			b.WriteString(active)
+			col = 0
+		}
+		b.WriteString(token)
+		col += w
+	}
+	return append(lines, b.String())
+}
+
+// layout applies --truncate or --wrap to a highlighted line.
+func (o *options) layout(line string) string {
+	switch {
+	case o.truncate.set:
+		return truncateANSI(line, o.truncate.width())
+	case o.wrap.set:
+		return strings.Join(wrapANSI(line, o.wrap.width()), "\n")
+	}
+	return line
+}
+
+// emit highlights a record and writes it to stdout, or with --align buffers
+// it to be aligned with the lines around it. It reports whether anything in
+// the record was highlighted.
+func (o *options) emit(m *matcher, rec record) bool {
+	output, matched := o.format(m, rec)
+	if o.align {
+		if output != "" {
+			o.aligned = append(o.aligned, alignedOutput{output, rec.end})
+		}
+		if len(o.aligned) >= alignWindow {
+			o.flushAligned()
+		}
+		return matched
+	}
+	fmt.Print(output)
+	return matched
+}
+
+// format highlights a record for output, followed by its end and after the
+// prefix of its file. With -o only the highlights are kept, each on its own,
+// and with -R records without highlights are left out. It reports whether
+// anything in the record was highlighted.
+func (o *options) format(m *matcher, rec record) (string, bool) {
+	text, rewritten := o.rewrite(o.cutLine(o.reshape(o.prepare(rec.text))))
+	var syntax []span
+	if o.prettyJSONIndent.set {
+		var pretty string
+		if pretty, syntax = o.prettyJSON(text); pretty != text {
+			// The colors of --replace text no longer line up
+			rewritten = nil
+		}
+		text = pretty
+	}
+	if o.syntaxLanguage != nil && syntax == nil {
+		syntax = o.syntaxLanguage(text, o.syntaxColors)
+	}
+	syntax = overlaySpans(syntax, rewritten)
+	var guides []int
+	if o.rainbowBrackets || o.indentGuides {
+		var brackets []span
+		brackets, guides = o.nest(rec.source, text)
+		syntax = overlaySpans(syntax, brackets)
+	}
+	if o.extractor != nil {
+		return o.formatExtract(m, rec, text)
+	}
+	// Follow the ::until blocks through every line, even those -R leaves out
+	block := m.block(text)
+	replacements := m.find(text)
+	if len(o.recursive) > 0 && len(replacements) == 0 {
+		return "", false
+	}
+	prefix := o.prefix(rec)
+	if o.onlyMatching {
+		var output strings.Builder
+		for _, r := range replacements {
+			output.WriteString(o.layout(prefix+r.text) + rec.end)
+		}
+		return output.String(), len(replacements) > 0
+	}
+	opts := m.opts
+	if o.tint {
+		opts.tint = o.sourceColors[rec.source].tint
+	}
+	if len(o.regions) > 0 {
+		if color := o.regionColor(rec.source, text); color != "" {
+			opts.tint = color
+		}
+	}
+	if block != "" {
+		opts.tint = block
+	}
+	opts.syntax = syntax
+	opts.guides = guides
+	return o.layoutLines(prefix, opts.render(text, replacements)) + rec.end, len(replacements) > 0
+}
+
+// layoutLines lays out each line of text after the prefix, for records that
+// span several lines, as with --pretty-json: every line is prefixed, and
+// truncated or wrapped on its own.
+func (o *options) layoutLines(prefix, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = o.layout(prefix + line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// setting is one resolved option shown by `ch preview`, with where its value
+// came from.
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+// describeRule renders a rule's pattern in the colors it will be highlighted
+// with, plus a short description of how it matches.
+func describeRule(cfg wordConfig) (rendered, kind string) {
+	switch {
+	case cfg.groups != nil:
+		var parts []string
+		names := cfg.re.SubexpNames()
+		for _, g := range cfg.groups {
+			name := names[g.index]
+			if name == "" {
+				name = fmt.Sprintf("$%d", g.index)
+			}
+			parts = append(parts, g.color+name+Reset)
+		}
+		rendered, kind = cfg.original+"  "+strings.Join(parts, " "), "regex, per-group colors"
+	case cfg.re != nil && cfg.group > 0:
+		rendered, kind = span{color: cfg.color, effect: cfg.effect}.render(cfg.original), fmt.Sprintf("regex, capture group %d", cfg.group)
+	case cfg.re != nil:
+		rendered, kind = span{color: cfg.color, effect: cfg.effect}.render(cfg.original), "regex"
+	default:
+		rendered, kind = span{color: cfg.color, effect: cfg.effect}.render(cfg.original), "literal"
+	}
+	if cfg.caseSensitive {
+		kind += ", case-sensitive"
+	}
+	if cfg.strictWord {
+		kind += ", whole word"
+	}
+	return rendered, kind
+}
+
+// runPreview implements `ch preview`: it prints each rule rendered in its
+// assigned color and the settings resolved from flags, environment and
+// config files, so a rule set can be checked before attaching it to a stream.
+func runPreview(w io.Writer, configs []wordConfig, settings []setting) {
+	fmt.Fprintln(w, "Rules:")
+	if len(configs) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for i, cfg := range configs {
+		rendered, kind := describeRule(cfg)
+		fmt.Fprintf(w, "  %2d. %s  (%s)\n", i+1, rendered, kind)
+	}
+
+	fmt.Fprintln(w, "\nSettings:")
+	for _, s := range settings {
+		fmt.Fprintln(w, strings.TrimRight("  "+padRight(s.name, 18)+" "+padRight(s.value, 24)+" "+s.source, " "))
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile is a named, shareable set of highlight rules, selected with
+// --profile. User profiles are read from $XDG_CONFIG_HOME/ch/presets/*.yaml
+// and take precedence over built-in profiles of the same name.
+type profile struct {
+	Description   string   `yaml:"description,omitempty"`
+	Rules         []string `yaml:"rules"`
+	CaseSensitive bool     `yaml:"case_sensitive,omitempty"`
+	WholeWord     bool     `yaml:"whole_word,omitempty"`
+	Background    bool     `yaml:"background,omitempty"`
+}
+
+// builtinProfiles ship with ch for common log formats.
+var builtinProfiles = map[string]*profile{
+	"levels": {
+		Description: "log levels",
+		Rules: []string{
+			"/\\b(fatal|panic|crit(ical)?)\\b/::red",
+			"/\\berr(or)?\\b/::red",
+			"/\\bwarn(ing)?\\b/::orange",
+			"/\\binfo\\b/::green",
+			"/\\b(debug|trace)\\b/::blue",
+		},
+	},
+	"http": {
+		Description: "HTTP methods and status codes",
+		Rules: []string{
+			"/\\b(GET|HEAD|OPTIONS)\\b/::blue",
+			"/\\b(POST|PUT|PATCH)\\b/::orange",
+			"/\\bDELETE\\b/::pink",
+			"/ (2\\d\\d) /$1::green",
+			"/ (3\\d\\d) /$1::blue",
+			"/ (4\\d\\d) /$1::orange",
+			"/ (5\\d\\d) /$1::red",
+		},
+		CaseSensitive: true,
+	},
+	"structure": {
+		Description: "quoted strings and bracketed text",
+		Rules: []string{
+			"/\"(?:[^\"\\\\]|\\\\.)*\"/::green",
+			"/(?:^|\\W)('[^']*')/$1::green",
+			"/\\[[^\\[\\]]*\\]/::purple",
+			"/\\([^()]*\\)/::blue",
+		},
+	},
+}
+
+// presetsDir is where user profile files live.
+func presetsDir() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "presets")
+	}
+	return ""
+}
+
+// readProfile parses a profile file.
+func readProfile(path string) (*profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &profile{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// loadProfile finds a profile by name, preferring user preset files over the
+// built-in profiles.
+func loadProfile(name string) (*profile, error) {
+	if dir := presetsDir(); dir != "" {
+		p, err := readProfile(filepath.Join(dir, name+".yaml"))
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if p, ok := builtinProfiles[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown profile '%s'", name)
+}
+
+// profileNames lists the built-in and user profiles.
+func profileNames() []string {
+	seen := make(map[string]bool)
+	for name := range builtinProfiles {
+		seen[name] = true
+	}
+	if dir := presetsDir(); dir != "" {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		for _, path := range matches {
+			seen[strings.TrimSuffix(filepath.Base(path), ".yaml")] = true
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readPatternFile reads a file with one rule per line. Blank lines and lines
+// starting with # are skipped.
+func readPatternFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pattern file: %v", err)
+	}
+	var rules []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, line)
+	}
+	return rules, nil
+}
+
+// rcFileName is the project-local rules file, in profile format.
+const rcFileName = ".chrc"
+
+// findRCFile walks up from dir looking for a .chrc file, returning "" if
+// there is none.
+func findRCFile(dir string) string {
+	for {
+		path := filepath.Join(dir, rcFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// validate checks that a profile has rules and that they parse, with valid
+// colors.
+func (p *profile) validate() error {
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("profile has no rules")
+	}
+	for _, rule := range p.Rules {
+		parts := splitRule(rule, ruleSep)
+		if len(parts) >= 2 && parts[1] != "" && !isGroupColorSpec(parts[1]) && parseColorEffect(parts[1], false) == nil {
+			if _, err := parseColor(parts[1], false); err != nil {
+				return fmt.Errorf("rule %q: invalid color '%s': %v", rule, parts[1], err)
+			}
+		}
+	}
+	if _, err := parseArgs(p.Rules, parseOptions{caseSensitive: p.CaseSensitive, background: p.Background}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeProfile strictly parses profile YAML, rejecting unknown fields.
+func decodeProfile(data []byte) (*profile, error) {
+	p := &profile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// fetchProfile reads profile data from an http(s) URL or a local file.
+func fetchProfile(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	resp, err := httpGet(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Profiles are small; cap the download in case the URL is wrong
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// profileNameFrom derives a profile name from a file path or URL.
+func profileNameFrom(source string) string {
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" {
+		source = u.Path
+	}
+	base := path.Base(filepath.ToSlash(source))
+	return strings.TrimSuffix(strings.TrimSuffix(base, ".yaml"), ".yml")
+}
+
+// exportProfile writes the named profile as YAML.
+func exportProfile(w io.Writer, name string) error {
+	p, err := loadProfile(name)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// importProfile validates a profile from a file or URL and saves it to the
+// presets directory under name, or a name derived from the source.
+func importProfile(w io.Writer, source, name string, force bool) error {
+	data, err := fetchProfile(source)
+	if err != nil {
+		return err
+	}
+	p, err := decodeProfile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", source, err)
+	}
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("%s: %v", source, err)
+	}
+
+	if name == "" {
+		name = profileNameFrom(source)
+	}
+	if name == "" || name == "." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid profile name '%s' (use --name)", name)
+	}
+	dir := presetsDir()
+	if dir == "" {
+		return fmt.Errorf("cannot determine the config directory")
+	}
+	dest := filepath.Join(dir, name+".yaml")
+	if _, err := os.Stat(dest); err == nil && !force {
+		return fmt.Errorf("profile '%s' already exists at %s (use --force to replace it)", name, dest)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Imported profile '%s' (%d rules) to %s\n", name, len(p.Rules), dest)
+	return nil
+}
+
+// runProfile implements `ch profile list|export|import`.
+func runProfile(w io.Writer, args []string, name string, force bool) error {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		for _, n := range profileNames() {
+			desc := ""
+			if p, err := loadProfile(n); err == nil {
+				desc = p.Description
+			}
+			fmt.Fprintln(w, padRight(n, 16), desc)
+		}
+		return nil
+	case len(args) == 2 && args[0] == "export":
+		return exportProfile(w, args[1])
+	case len(args) == 2 && args[0] == "import":
+		return importProfile(w, args[1], name, force)
+	}
+	return errUsage
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// redactModes are the accepted --redact-mode values: mask secrets with a
+// fixed run of blocks, or with a keyed hash, so equal secrets can still be
+// told apart and followed through a log.
+var redactModes = []string{"block", "hash"}
+
+// redactMask replaces secrets with --redact-mode block. It has a fixed
+// length so the mask doesn't give away the secret's.
+const redactMask = "█████"
+
+// secretPatterns are the built-in detectors of --redact-secrets, for common
+// shapes of credentials and personal data. With a $1 suffix only the group
+// is masked, keeping the key it was found under readable.
+var secretPatterns = []string{
+	`/\b(?:AKIA|ASIA)[0-9A-Z]{16}\b/`,                 // AWS access key IDs
+	`/\bgh[pousr]_[A-Za-z0-9]{36,}\b/`,                // GitHub tokens
+	`/\bgithub_pat_\w{22,}\b/`,                        // GitHub fine-grained tokens
+	`/\bxox[abposr]-[A-Za-z0-9-]{10,}/`,               // Slack tokens
+	`/\b[sr]k_(?:live|test)_[A-Za-z0-9]{16,}\b/`,      // Stripe keys
+	`/\bAIza[0-9A-Za-z_-]{35}\b/`,                     // Google API keys
+	`/\beyJ[\w-]{8,}\.eyJ[\w-]{8,}\.[\w-]+/`,          // JWTs
+	`/-----BEGIN [A-Z ]*PRIVATE KEY-----/`,            // PEM private keys
+	`/(?i)\b(?:bearer|basic)\s+([\w.~+\/-]{8,}=*)/$1`, // Authorization headers
+	`/(?i)(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret)["']?\s*[:=]\s*["']?([^\s"',;&]+)/$1`,
+	`/:\/\/[^\s:@\/]+:([^\s@\/]+)@/$1`,                               // passwords in URLs
+	`/\b[\w.+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b/`, // email addresses
+}
+
+// parseRedact compiles the --redact patterns, followed by the built-in
+// detectors with --redact-secrets. Patterns are matched like rules, as
+// literals or /regex/, and follow -s and -S.
+func (o *options) parseRedact() ([]wordConfig, error) {
+	var redact []wordConfig
+	for _, pattern := range o.redact {
+		regex := !o.fixedStrings && isRegexRule(pattern)
+		cs := o.caseSensitive || o.smartCase && hasUppercase(pattern, regex)
+		cond, err := condition(pattern, cs, o.fixedStrings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --redact pattern: %v", err)
+		}
+		redact = append(redact, cond)
+	}
+	if o.redactSecrets {
+		for _, pattern := range secretPatterns {
+			cond, err := condition(pattern, true, false)
+			if err != nil {
+				return nil, fmt.Errorf("invalid built-in secret pattern: %v", err)
+			}
+			redact = append(redact, cond)
+		}
+	}
+	if len(redact) > 0 && o.redactMode == "hash" {
+		o.redactKey = make([]byte, 16)
+		if _, err := rand.Read(o.redactKey); err != nil {
+			return nil, err
+		}
+	}
+	return redact, nil
+}
+
+// mask returns what a secret is shown as, in the --redact-mode. Hashes are
+// keyed with a random key for each run, so they can't be looked up to find
+// short secrets such as email addresses.
+func (o *options) mask(secret string) string {
+	if o.redactMode != "hash" {
+		return redactMask
+	}
+	h := hmac.New(sha256.New, o.redactKey)
+	h.Write([]byte(secret))
+	return "[REDACTED:" + hex.EncodeToString(h.Sum(nil))[:8] + "]"
+}
+
+// redactText masks the matches of the --redact patterns in text.
+func (o *options) redactText(text string) string {
+	for _, cfg := range o.redactPatterns {
+		matches := findMatches(text, cfg)
+		if len(matches) == 0 {
+			continue
+		}
+		var b strings.Builder
+		pos := 0
+		for _, m := range matches {
+			if m.start < pos {
+				continue
+			}
+			b.WriteString(text[pos:m.start])
+			b.WriteString(o.mask(text[m.start:m.end]))
+			pos = m.end
+		}
+		b.WriteString(text[pos:])
+		text = b.String()
+	}
+	return text
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// matcher is a compiled rule set with the options to apply it. Reloading
+// builds a new matcher and swaps it in whole, so each line is highlighted
+// entirely by either the old rules or the new ones.
+type matcher struct {
+	configs []wordConfig
+	opts    highlightOptions
+	// required is how many of the leading configs must all match a line
+	// for it to have highlights, with --all-of
+	required int
+}
+
+// newMatcher compiles the rules from args and the rule files with the
+// highlighting options.
+func (o *options) newMatcher(args []string, explain *explainer) (*matcher, error) {
+	configs, err := parseArgs(o.rules(args), o.parseOptions())
+	if err != nil {
+		return nil, err
+	}
+	required := 0
+	if o.allOf {
+		required = len(o.exprs) + len(args)
+	}
+	return &matcher{
+		configs:  configs,
+		required: required,
+		opts: highlightOptions{
+			wholeWord:  o.wholeWord,
+			strictWord: o.strictWord,
+			wordChars:  o.wordChars,
+			showAll:    o.showAll,
+			focus:      o.focus,
+			invert:     o.invert,
+			icons:      o.icons,
+			explain:    explain,
+		},
+	}, nil
+}
+
+// find returns the highlights of line.
+func (m *matcher) find(line string) []replacement {
+	for i, cfg := range m.configs[:m.required] {
+		if cfg.skips(line) != "" || len(findMatches(line, cfg)) == 0 {
+			m.opts.explain.nextLine(line)
+			m.opts.explain.logf("rule %d %q: no match, and --all-of needs every rule to match", i+1, cfg.original)
+			return nil
+		}
+	}
+	return findReplacements(line, m.configs, m.opts)
+}
+
+// block follows the blocks of the rules with an until= modifier through
+// line, and returns the color of the block line is in, or "" if none. A
+// match opens its rule's block, coloring the whole line and those after it,
+// until a line matches the until pattern; that line is outside the block,
+// unless it matches the rule again. The first rule's block wins.
+func (m *matcher) block(line string) string {
+	color := ""
+	for _, cfg := range m.configs {
+		if cfg.until == nil {
+			continue
+		}
+		if *cfg.inBlock && len(findMatches(line, *cfg.until)) > 0 {
+			*cfg.inBlock = false
+		}
+		if !*cfg.inBlock && cfg.skips(line) == "" && len(findMatches(line, cfg)) > 0 {
+			*cfg.inBlock = true
+		}
+		if *cfg.inBlock && color == "" {
+			color = cfg.color
+		}
+	}
+	return color
+}
+
+// reloadOnHangup rebuilds the matcher whenever ch receives SIGHUP. If the
+// rebuild fails, the previous rules stay in effect.
+func reloadOnHangup(current *atomic.Pointer[matcher], rebuild func() (*matcher, error)) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			reloadMatcher(current, rebuild)
+		}
+	}()
+}
+
+// reloadMatcher swaps in a rebuilt matcher, reporting the outcome on stderr.
+func reloadMatcher(current *atomic.Pointer[matcher], rebuild func() (*matcher, error)) {
+	m, err := rebuild()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: reload failed, keeping the previous rules: %v\n", err)
+		return
+	}
+	current.Store(m)
+	fmt.Fprintf(os.Stderr, "ch: reloaded %d rules\n", len(m.configs))
+}
+
+// reloadDelay coalesces the bursts of events editors produce when saving.
+const reloadDelay = 100 * time.Millisecond
+
+// reloadOnChange rebuilds the matcher when any of the files changes. It
+// watches the files' directories rather than the files themselves, so edits
+// that replace a file by renaming over it are seen too. Files that don't
+// exist yet are picked up when they're created.
+func reloadOnChange(current *atomic.Pointer[matcher], files []string, rebuild func() (*matcher, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	watched := make(map[string]bool)
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		watched[path] = true
+		// Missing directories are skipped; there's nothing to reload from
+		_ = watcher.Add(filepath.Dir(path))
+	}
+
+	go func() {
+		var timer <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if watched[event.Name] && !event.Has(fsnotify.Chmod) {
+					timer = time.After(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(os.Stderr, "Warning: watching rule files: %v\n", err)
+			case <-timer:
+				timer = nil
+				reloadMatcher(current, rebuild)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// replaceSep separates the pattern of a --replace from its replacement text.
+const replaceSep = "=>"
+
+// substitution is a --replace: matches of pattern are rewritten to text,
+// colored in color if set. The substitutions of --drop and --drop-field
+// replace matches, or the values of field, with a placeholder instead.
+type substitution struct {
+	pattern wordConfig
+	text    string
+	color   string
+	drop    bool
+	field   string
+}
+
+// parseReplace compiles the --replace substitutions, after those of --drop
+// and --drop-field. Patterns are matched like rules, as literals or /regex/,
+// and follow -s and -S. The text can end with the ::color of the rewritten
+// text.
+func (o *options) parseReplace() ([]substitution, error) {
+	subs, err := o.parseDrop()
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range o.replace {
+		pattern, rest, found := strings.Cut(spec, replaceSep)
+		if !found || pattern == "" {
+			return nil, fmt.Errorf("invalid --replace '%s' (use PATTERN%sTEXT[::color])", spec, replaceSep)
+		}
+		regex := !o.fixedStrings && isRegexRule(pattern)
+		cs := o.caseSensitive || o.smartCase && hasUppercase(pattern, regex)
+		cond, err := condition(pattern, cs, o.fixedStrings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --replace pattern: %v", err)
+		}
+		parts := splitRule(rest, ruleSep)
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid --replace '%s' (use PATTERN%sTEXT[::color], and \\:: for a literal ::)", spec, replaceSep)
+		}
+		s := substitution{pattern: cond, text: parts[0]}
+		if len(parts) == 2 && parts[1] != "" {
+			if s.color, err = parseColor(parts[1], o.background); err != nil {
+				return nil, fmt.Errorf("invalid --replace color '%s': %v", parts[1], err)
+			}
+		}
+		subs = append(subs, s)
+	}
+	return subs, nil
+}
+
+// edit replaces text[start:end] with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// edits returns the rewrites of s in text, in order of position.
+func (s substitution) edits(text string) []edit {
+	var edits []edit
+	if s.field != "" {
+		edits = fieldEdits(text, s.field)
+	} else {
+		edits = s.matchEdits(text)
+	}
+	if s.drop {
+		for i, e := range edits {
+			edits[i].text = dropPlaceholder(e.end - e.start)
+		}
+	}
+	return edits
+}
+
+// matchEdits returns the rewrites of the matches of s in text. Regex
+// patterns expand $1, ${name} and the like in the replacement text, as
+// regexp.Expand does, and with a $N suffix only that group is replaced.
+func (s substitution) matchEdits(text string) []edit {
+	var edits []edit
+	pos := 0
+	if re := s.pattern.re; re != nil {
+		for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*s.pattern.group], m[2*s.pattern.group+1]
+			if start < pos {
+				continue
+			}
+			edits = append(edits, edit{start, end, string(re.ExpandString(nil, s.text, text, m))})
+			pos = end
+		}
+		return edits
+	}
+	for _, m := range findMatches(text, s.pattern) {
+		// Literal matches can overlap, as with aa in aaa
+		if m.start < pos {
+			continue
+		}
+		edits = append(edits, edit{m.start, m.end, s.text})
+		pos = m.end
+	}
+	return edits
+}
+
+// rewrite applies the --replace substitutions to text, in order, each to the
+// result of the ones before it. It returns the colors of the rewritten text,
+// by position; text that a later substitution rewrites again loses its color.
+func (o *options) rewrite(text string) (string, []span) {
+	var spans []span
+	for _, s := range o.substitutions {
+		edits := s.edits(text)
+		if len(edits) == 0 {
+			continue
+		}
+		var b strings.Builder
+		var moved []span
+		pos := 0
+		// keep copies text[pos:end], moving the colors within it along
+		keep := func(end int) {
+			shift := b.Len() - pos
+			for _, sp := range spans {
+				if sp.start >= pos && sp.end <= end {
+					sp.start += shift
+					sp.end += shift
+					moved = append(moved, sp)
+				}
+			}
+			b.WriteString(text[pos:end])
+		}
+		for _, e := range edits {
+			keep(e.start)
+			if s.color != "" && e.text != "" {
+				moved = append(moved, span{start: b.Len(), end: b.Len() + len(e.text), color: s.color})
+			}
+			b.WriteString(e.text)
+			pos = e.end
+		}
+		keep(len(text))
+		text, spans = b.String(), moved
+	}
+	return text, spans
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// speedFlag is a playback speed like 4x, 0.5x or 2.
+type speedFlag float64
+
+func (f *speedFlag) String() string {
+	if *f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64) + "x"
+}
+
+func (f *speedFlag) Set(value string) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(value), "x"), 64)
+	if err != nil || v <= 0 {
+		return fmt.Errorf("want a speed like 4x or 0.5x")
+	}
+	*f = speedFlag(v)
+	return nil
+}
+
+// maxReplayGap caps the pause between replayed lines, so quiet hours in a
+// log don't stall the replay.
+const maxReplayGap = 5 * time.Second
+
+// replay paces records by their timestamps, speed times faster than they
+// were logged. Records from session files are paced by when they were
+// recorded instead. Records without a timestamp follow the one before at once.
+func replay(in <-chan record, speed float64) <-chan record {
+	out := make(chan record, 64)
+	go func() {
+		defer close(out)
+		var (
+			last   time.Time
+			lastAt time.Duration
+		)
+		for rec := range in {
+			if rec.timed {
+				if rec.at > lastAt {
+					time.Sleep(min(time.Duration(float64(rec.at-lastAt)/speed), maxReplayGap))
+				}
+				lastAt = rec.at
+			} else if t, ok := parseTimestamp(rec.text); ok {
+				if !last.IsZero() && t.After(last) {
+					time.Sleep(min(time.Duration(float64(t.Sub(last))/speed), maxReplayGap))
+				}
+				last = t
+			}
+			out <- rec
+		}
+	}()
+	return out
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// sanitizeEscapes removes terminal escape sequences from untrusted input,
+// except SGR sequences (colors and text attributes), which are harmless and
+// common in piped output. Without this, a log line could retitle the
+// terminal, move the cursor, write to the clipboard or worse.
+//
+// Removed are CSI sequences other than SGR, OSC, DCS, APC, PM and SOS
+// strings, nF escapes such as character set selections, two-byte escapes,
+// and C1 control characters along with the sequences they introduce.
+func sanitizeEscapes(line string) string {
+	// C1 controls are encoded in UTF-8 as \xc2\x80 to \xc2\x9f
+	if !strings.Contains(line, "\x1b") && !strings.Contains(line, "\xc2") {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		// Find the introducer: ESC and the byte after it, or the C1 control
+		// equivalent to that pair
+		var kind byte
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == 0x1b && i+1 < len(line):
+			// A multibyte rune after ESC goes with it whole, so no stray
+			// bytes of it are left behind
+			next, nextSize := utf8.DecodeRuneInString(line[i+1:])
+			kind, size = line[i+1], 1+nextSize
+			if next >= utf8.RuneSelf {
+				kind = 0
+			}
+		case r == 0x1b:
+		case r >= 0x80 && r <= 0x9f:
+			kind = byte(r - 0x40)
+		default:
+			b.WriteString(line[i : i+size])
+			i += size
+			continue
+		}
+
+		j := i + size
+		switch kind {
+		case '[':
+			// CSI: parameter bytes, intermediate bytes, then a final byte
+			for j < len(line) && line[j] >= 0x20 && line[j] <= 0x3f {
+				j++
+			}
+			if j < len(line) && line[j] >= 0x40 && line[j] <= 0x7e {
+				if line[j] == 'm' && r == 0x1b {
+					b.WriteString(line[i : j+1])
+				}
+				j++
+			}
+		case ' ', '!', '"', '#', '$', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/':
+			// nF escapes, like ESC ( B selecting a character set: more
+			// intermediate bytes, then a final byte
+			for j < len(line) && line[j] >= 0x20 && line[j] <= 0x2f {
+				j++
+			}
+			if j < len(line) && line[j] >= 0x30 && line[j] <= 0x7e {
+				j++
+			}
+		case ']', 'P', '_', '^', 'X':
+			// String sequences run until BEL or ST (ESC \ or its C1 form)
+			for j < len(line) && line[j] != 0x07 && !strings.HasPrefix(line[j:], "\x1b\\") && !strings.HasPrefix(line[j:], "\u009c") {
+				j++
+			}
+			switch {
+			case j == len(line):
+			case line[j] == 0x07:
+				j++
+			default:
+				j += 2
+			}
+		}
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sharunkumar/ch/version"
+)
+
+// releasesURL is the GitHub API endpoint for the latest release.
+const releasesURL = "https://api.github.com/repos/sharunkumar/ch/releases/latest"
+
+// checksumsAsset is the release asset listing SHA-256 sums of the binaries,
+// in sha256sum format.
+const checksumsAsset = "checksums.txt"
+
+// release is the subset of the GitHub release API response we use.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the named asset.
+func (r *release) assetURL(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// binaryAssetName is the release asset name for this platform, e.g.
+// ch_linux_amd64 or ch_windows_amd64.exe.
+func binaryAssetName() string {
+	name := fmt.Sprintf("ch_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// httpGet fetches url, failing on non-2xx responses.
+func httpGet(url string) (*http.Response, error) {
+	resp, err := updateClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// latestRelease queries GitHub for the latest release.
+func latestRelease() (*release, error) {
+	resp, err := httpGet(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rel := &release{}
+	if err := json.NewDecoder(resp.Body).Decode(rel); err != nil {
+		return nil, fmt.Errorf("decoding release: %v", err)
+	}
+	return rel, nil
+}
+
+// expectedChecksum downloads the checksums asset and returns the SHA-256
+// listed for the named file.
+func expectedChecksum(rel *release, name string) (string, error) {
+	url, ok := rel.assetURL(checksumsAsset)
+	if !ok {
+		return "", fmt.Errorf("release %s has no %s", rel.TagName, checksumsAsset)
+	}
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum for %s in %s", name, checksumsAsset)
+}
+
+// replaceExecutable atomically swaps the running binary for newPath.
+func replaceExecutable(exe, newPath string) error {
+	if runtime.GOOS == "windows" {
+		// A running executable can't be overwritten on Windows, but it can
+		// be renamed out of the way
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(newPath, exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(newPath, exe)
+}
+
+// runSelfUpdate implements `ch self-update`: it downloads the latest release
+// binary for this platform, verifies its checksum and replaces the running
+// executable.
+func runSelfUpdate(w io.Writer, checkOnly, force bool) error {
+	rel, err := latestRelease()
+	if err != nil {
+		return fmt.Errorf("checking for updates: %v", err)
+	}
+	installed := version.Get().Version
+	if strings.TrimPrefix(rel.TagName, "v") == strings.TrimPrefix(installed, "v") && !force {
+		fmt.Fprintf(w, "ch %s is up to date\n", installed)
+		return nil
+	}
+	if checkOnly {
+		fmt.Fprintf(w, "ch %s is available (installed: %s)\n", rel.TagName, installed)
+		return nil
+	}
+
+	name := binaryAssetName()
+	url, ok := rel.assetURL(name)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", rel.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	want, err := expectedChecksum(rel, name)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	// Download next to the executable so the final rename stays on one
+	// filesystem
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".ch-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write to %s: %v", filepath.Dir(exe), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	fmt.Fprintf(w, "Downloading ch %s (%s)...\n", rel.TagName, name)
+	resp, err := httpGet(url)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	resp.Body.Close()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %v", name, err)
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if err := replaceExecutable(exe, tmp.Name()); err != nil {
+		return fmt.Errorf("replacing %s: %v", exe, err)
+	}
+
+	fmt.Fprintf(w, "Updated %s to %s\n", exe, rel.TagName)
+	return nil
+}
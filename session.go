@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// A session file, written by --record, holds the input of a ch session with
+// its timing, one JSON value per line, much like an asciinema recording. The
+// header comes first:
+//
+//	{"ch_session":1,"started":"2024-05-01T12:00:00Z"}
+//
+// and then one event per record: the seconds since the start, the source
+// ("" for stdin), the text and the terminator:
+//
+//	[0.25,"app.log","GET /health 200","\n"]
+const sessionVersion = 1
+
+// sessionHeader is the first line of a session file.
+type sessionHeader struct {
+	Version int       `json:"ch_session"`
+	Started time.Time `json:"started"`
+}
+
+// recordSession copies every record from in to the session file at path as it
+// passes through.
+func recordSession(in <-chan record, path string) (<-chan record, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	header, _ := json.Marshal(sessionHeader{Version: sessionVersion, Started: start.UTC()})
+	if _, err := fmt.Fprintf(f, "%s\n", header); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	out := make(chan record, 64)
+	go func() {
+		defer close(out)
+		defer f.Close()
+		failed := false
+		for rec := range in {
+			// End-of-source markers aren't lines; playback sends its own
+			if rec.eof {
+				out <- rec
+				continue
+			}
+			event, _ := json.Marshal([]any{time.Since(start).Seconds(), rec.source, rec.text, rec.end})
+			// Write each event straight away, so the recording survives ^C
+			if _, err := fmt.Fprintf(f, "%s\n", event); err != nil && !failed {
+				fmt.Fprintf(os.Stderr, "Warning: recording stopped: %v\n", err)
+				failed = true
+			}
+			out <- rec
+		}
+	}()
+	return out, nil
+}
+
+// isSession reports whether the file at path is a session file.
+func isSession(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	start := make([]byte, len(`{"ch_session"`))
+	n, _ := f.Read(start)
+	return string(start[:n]) == `{"ch_session"`
+}
+
+// sessionSources returns the sources recorded in a session file, counting
+// stdin as the file itself, as readSession does.
+func sessionSources(path string) []string {
+	var sources []string
+	seen := make(map[string]bool)
+	out := make(chan record)
+	go func() {
+		(&options{}).readSession(path, out)
+		close(out)
+	}()
+	for rec := range out {
+		if !seen[rec.source] {
+			seen[rec.source] = true
+			sources = append(sources, rec.source)
+		}
+	}
+	return sources
+}
+
+// readSession sends the records of a session file, with the time each was
+// recorded at for --replay. Records read from stdin are attributed to the
+// session file.
+func (o *options) readSession(path string, out chan<- record) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), maxRecordSize*2)
+	scanner.Scan()
+	var header sessionHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != sessionVersion {
+		return fmt.Errorf("unsupported session file")
+	}
+	// Records are numbered per source, as they were read
+	var sources []string
+	lines := make(map[string]int)
+	offsets := make(map[string]int64)
+	for line := 1; scanner.Scan(); line++ {
+		var (
+			seconds           float64
+			source, text, end string
+		)
+		event := []any{&seconds, &source, &text, &end}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("bad event on line %d: %v", line+1, err)
+		}
+		if source == "" {
+			source = path
+		}
+		if lines[source] == 0 {
+			sources = append(sources, source)
+		}
+		lines[source]++
+		at := time.Duration(seconds * float64(time.Second))
+		out <- record{text: strings.Clone(text), end: end, source: source, line: lines[source], offset: offsets[source], at: at, timed: true, read: header.Started.Add(at).Local()}
+		offsets[source] += int64(len(text) + len(end))
+	}
+	if o.merging() {
+		for _, source := range sources {
+			out <- record{source: source, eof: true}
+		}
+	}
+	return scanner.Err()
+}
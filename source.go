@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// record is one unit of input to highlight, usually a line.
+type record struct {
+	text   string
+	end    string    // terminator to write after it
+	source string    // the file it came from, "" for stdin
+	line   int       // its number within the source, counting from 1
+	offset int64     // where it starts within the source, in bytes
+	read   time.Time // when it was read, for --ts and --elapsed
+	eof    bool      // marks the end of the source for --merge-by-time
+	// at is when a record from a session file was recorded, if timed
+	at    time.Duration
+	timed bool
+}
+
+// splitFiles separates the rules from the files given after --.
+func splitFiles(args []string) (rules, files []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// sourceColor is the color of a source's line prefix, and the tint of its
+// text with --tint.
+type sourceColor struct {
+	prefix, tint string
+}
+
+// sourceHues is how many distinct hues sources are spread over.
+const sourceHues = 64
+
+// tintSaturation keeps tints muted, so highlights stand out from them.
+const tintSaturation = 0.3
+
+// sourceColors gives each source its own color, away from the palette the
+// rules are colored from. A source's color follows from its name, so a
+// service keeps its color from run to run, unless another source took it.
+func sourceColors(sources []string) map[string]sourceColor {
+	colors := make(map[string]sourceColor, len(sources))
+	used := make(map[int]bool)
+	for _, source := range sources {
+		if _, ok := colors[source]; ok {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(source))
+		n := int(h.Sum32() % sourceHues)
+		for used[n] && len(used) < sourceHues {
+			n = (n + 1) % sourceHues
+		}
+		used[n] = true
+		hue := 20 + float64(n)*goldenAngle
+		r, g, b := hslToRGB(hue, rainbowSaturation, rainbowLightness)
+		tr, tg, tb := hslToRGB(hue, tintSaturation, rainbowLightness)
+		colors[source] = sourceColor{prefix: rgbToANSI(r, g, b, false), tint: rgbToANSI(tr, tg, tb, false)}
+	}
+	return colors
+}
+
+// lineNumberWidth and byteOffsetWidth are the widths line numbers and byte
+// offsets are padded to, as cat -n does, so the lines after them align.
+const (
+	lineNumberWidth = 6
+	byteOffsetWidth = 10
+)
+
+// prefix returns what is written before a record: the --label, the time it
+// was read with --ts and the time elapsed with --elapsed, the name of its
+// file when reading several, padded so the lines after it align, then its
+// line number with -n and its byte offset with --byte-offset. With -R the
+// line number and offset follow the name instead, as with grep.
+func (o *options) prefix(rec record) string {
+	stamp := o.labelPrefix
+	if o.ts.set {
+		stamp += o.timestamp(rec.read)
+	}
+	if o.elapsedSince.set {
+		stamp += o.elapsed(rec)
+	}
+	var position string
+	if o.lineNumbers {
+		position += o.numberColor + fmt.Sprintf("%*d", lineNumberWidth, rec.line) + Reset + " "
+	}
+	if o.byteOffset {
+		position += o.numberColor + fmt.Sprintf("%*d", byteOffsetWidth, rec.offset) + Reset + " "
+	}
+	color, ok := o.sourceColors[rec.source]
+	if !ok || o.noFilename {
+		return stamp + position
+	}
+	if len(o.recursive) > 0 {
+		position = strconv.Itoa(rec.line) + ":"
+		if o.byteOffset {
+			position += strconv.FormatInt(rec.offset, 10) + ":"
+		}
+		return stamp + color.prefix + rec.source + ":" + Reset + o.numberColor + position + Reset
+	}
+	return stamp + color.prefix + rec.source + ":" + Reset + strings.Repeat(" ", o.nameWidth-displayWidth(rec.source)+1) + position
+}
+
+// walkFiles lists the regular files under each directory, in lexical order,
+// that pass --include and --exclude. Files and directories ignored by a
+// .gitignore file are skipped, as is .git itself, unless --no-ignore is set.
+// Entries that can't be read are skipped with a warning.
+func (o *options) walkFiles(dirs []string) []string {
+	var files []string
+	for _, root := range dirs {
+		ignores := map[string]ignoreList{}
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				return nil
+			}
+			parent := ignores[filepath.Dir(path)]
+			if d.IsDir() {
+				if path != root && (o.excluded(path) || !o.noIgnore && (d.Name() == ".git" || parent.ignored(path, true))) {
+					return filepath.SkipDir
+				}
+				if !o.noIgnore {
+					ignores[path] = parent.withFile(path)
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && o.selected(path) && (o.noIgnore || !parent.ignored(path, false)) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// selected reports whether a file passes the --include and --exclude globs.
+func (o *options) selected(path string) bool {
+	if o.excluded(path) {
+		return false
+	}
+	if len(o.include) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(o.include, func(glob string) bool {
+		ok, _ := filepath.Match(glob, filepath.Base(path))
+		return ok
+	})
+}
+
+// excluded reports whether a file or directory matches an --exclude glob.
+func (o *options) excluded(path string) bool {
+	return slices.ContainsFunc(o.exclude, func(glob string) bool {
+		ok, _ := filepath.Match(glob, filepath.Base(path))
+		return ok
+	})
+}
+
+// resolveInputs checks that the input flags go together and lists the files
+// to read, filtered by --include and --exclude and expanded by -R. It also
+// picks the file name prefixes.
+func (o *options) resolveInputs() error {
+	o.readFiles = len(o.files) > 0 || len(o.recursive) > 0
+	inputs := 0
+	for _, given := range []bool{o.readFiles, o.listen != "", o.journal.set, o.eventLog != "", len(o.containers) > 0, len(o.pods) > 0, len(o.ssh) > 0} {
+		if given {
+			inputs++
+		}
+	}
+	switch {
+	case inputs > 1:
+		return fmt.Errorf("read from only one of files, -R, --listen, --journal, --eventlog and --ssh")
+	case o.follow && len(o.files) == 0:
+		return fmt.Errorf("-f needs files to follow, given after --")
+	case len(o.recursive) > 0 && (o.follow || o.tail > 0):
+		return fmt.Errorf("-R can't be used with -f or --tail")
+	case (o.listen != "" || o.eventLog != "") && o.tail > 0:
+		return fmt.Errorf("--tail can't be used with --listen or --eventlog")
+	case o.priority != "" && !o.journal.set:
+		return fmt.Errorf("--priority needs --journal")
+	case (len(o.ssh) > 0) != (o.sshCommand != ""):
+		return fmt.Errorf("--ssh and --cmd go together")
+	case len(o.ssh) > 0 && o.tail > 0:
+		return fmt.Errorf("--tail can't be used with --ssh; give the command its own, as in --cmd 'tail -n 100 -F app.log'")
+	}
+
+	if o.readFiles {
+		o.files = append(slices.DeleteFunc(o.files, func(path string) bool { return !o.selected(path) }), o.walkFiles(o.recursive)...)
+	}
+	o.sources = nil
+	for _, path := range o.files {
+		// A session file brings the sources it recorded
+		if isSession(path) {
+			o.sources = append(o.sources, sessionSources(path)...)
+		} else {
+			o.sources = append(o.sources, path)
+		}
+	}
+	switch {
+	case len(o.containers) > 0:
+		o.sources = o.containers
+	case len(o.pods) > 0:
+		o.sources = o.pods
+	case len(o.ssh) > 0:
+		o.sources = o.sshHosts()
+	}
+	// Lines are prefixed with their source when there are several
+	if len(o.sources) > 1 || len(o.recursive) > 0 {
+		o.sourceColors = sourceColors(o.sources)
+		for _, source := range o.sources {
+			o.nameWidth = max(o.nameWidth, displayWidth(source))
+		}
+	}
+	return nil
+}
+
+// followAll runs follow for each source concurrently and waits for all of
+// them, returning the first error. With several sources, errors are also
+// reported as they happen, since the others may never finish.
+func followAll(sources []string, follow func(source string) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := follow(source); err != nil {
+				err = fmt.Errorf("%s: %v", source, err)
+				once.Do(func() { firstErr = err })
+				if len(sources) > 1 {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// readCommand runs cmd and sends its output as records from source.
+func (o *options) readCommand(cmd *exec.Cmd, source string, out chan<- record) error {
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("running %s: %v", cmd.Args[0], err)
+	}
+	if err := o.readRecords(stdout, source, tailStart{}, out); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %v", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// defaultFollowTail is how many lines -f shows before following, as in tail.
+const defaultFollowTail = 10
+
+// startInputs starts reading the input: syslog messages with --listen, the
+// systemd journal with --journal, the Windows Event Log with --eventlog,
+// Docker containers with `ch docker`, Kubernetes pods with `ch kube`, remote
+// commands with --ssh, the files given after --, or stdin.
+// Records arrive on the returned channel, which is closed once all inputs
+// are exhausted; with -f, files are followed and never exhausted. The first
+// read error is sent on the error channel once the records channel closes.
+func (o *options) startInputs() (<-chan record, <-chan error) {
+	out := make(chan record, 64)
+	errc := make(chan error, 1)
+
+	if o.listen != "" {
+		go func() {
+			errc <- o.serveSyslog(out)
+			close(out)
+		}()
+		return out, errc
+	}
+	if len(o.ssh) > 0 {
+		go func() {
+			errc <- o.readSSH(out)
+			close(out)
+		}()
+		return out, errc
+	}
+	if len(o.pods) > 0 {
+		go func() {
+			errc <- o.readPods(out)
+			close(out)
+		}()
+		return out, errc
+	}
+	if len(o.containers) > 0 {
+		go func() {
+			errc <- o.readDocker(out)
+			close(out)
+		}()
+		return out, errc
+	}
+	if o.eventLog != "" {
+		go func() {
+			errc <- o.readEventLog(out)
+			close(out)
+		}()
+		return out, errc
+	}
+	if o.journal.set {
+		go func() {
+			errc <- o.readJournal(out)
+			close(out)
+		}()
+		return out, errc
+	}
+	if !o.readFiles {
+		go func() {
+			errc <- o.readRecords(os.Stdin, "", tailStart{keepLast: o.tail}, out)
+			close(out)
+		}()
+		return out, errc
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		if o.follow {
+			// Following never ends, so don't wait to report it
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		once.Do(func() { firstErr = err })
+	}
+	read := func(path string) {
+		if isSession(path) {
+			if err := o.readSession(path, out); err != nil {
+				fail(fmt.Errorf("%s: %v", path, err))
+			}
+			return
+		}
+		r, start, err := o.openFile(path)
+		if errors.Is(err, errBinary) {
+			fmt.Fprintf(os.Stderr, "ch: skipped binary file %s (read it with --binary)\n", path)
+			return
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer r.Close()
+		if err := o.readRecords(r, path, start, out); err != nil {
+			fail(fmt.Errorf("%s: %v", path, err))
+		}
+	}
+
+	if o.follow || o.mergeByTime {
+		// Followed files are read side by side, interleaving as they grow
+		for _, path := range o.files {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				read(path)
+			}()
+		}
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, path := range o.files {
+				read(path)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+		errc <- firstErr
+	}()
+	return out, errc
+}
+
+// errBinary reports a file that looks like binary data rather than text.
+var errBinary = errors.New("binary file")
+
+// binarySniffSize is how much of a file is checked for NUL bytes, as git does.
+const binarySniffSize = 8000
+
+// isBinary reports whether f starts with a NUL byte within binarySniffSize
+// bytes, which text in an ASCII-compatible encoding never has.
+func isBinary(f *os.File) bool {
+	buf := make([]byte, binarySniffSize)
+	n, _ := f.ReadAt(buf, 0)
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
+
+// tailStart is where reading an input starts with --tail: only its last
+// keepLast records are kept, or it was positioned offset bytes in, past
+// skipped records, by seeking. skipped is only counted for -n.
+type tailStart struct {
+	keepLast, skipped int
+	offset            int64
+}
+
+// openFile opens a file for reading. Compressed files are decompressed, and
+// other binary files are refused with errBinary, unless --binary is set or
+// NUL bytes are expected: with -0, or in an --encoding like UTF-16. With
+// --tail it starts at the last lines when they can be found by seeking;
+// otherwise it reports how many records readRecords should keep from the end.
+// With -f the file is followed, unless it is compressed.
+func (o *options) openFile(path string) (io.ReadCloser, tailStart, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, tailStart{}, err
+	}
+	tail := o.tail
+	if o.follow && tail == 0 {
+		tail = defaultFollowTail
+	}
+
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, tailStart{}, err
+	}
+	if r != nil {
+		return r, tailStart{keepLast: tail}, nil
+	}
+	if !o.binary && !o.nullData && o.inputEncoding == nil && isBinary(f) {
+		f.Close()
+		return nil, tailStart{}, errBinary
+	}
+
+	var start tailStart
+	if tail > 0 {
+		sep := o.recordSep()
+		if len(sep) == 1 {
+			if err := seekTail(f, tail, sep[0]); err != nil {
+				f.Close()
+				return nil, tailStart{}, err
+			}
+			if start.offset, err = f.Seek(0, io.SeekCurrent); err != nil {
+				f.Close()
+				return nil, tailStart{}, err
+			}
+			if o.lineNumbers {
+				if start.skipped, err = countBefore(f, start.offset, sep[0]); err != nil {
+					f.Close()
+					return nil, tailStart{}, err
+				}
+			}
+		} else {
+			start.keepLast = tail
+		}
+	}
+	if o.follow {
+		return &followReader{path: path, f: f}, start, nil
+	}
+	return f, start, nil
+}
+
+// readRecords scans r into records for source. If start.keepLast is set, only
+// the last keepLast records are sent, once r is exhausted.
+func (o *options) readRecords(r io.Reader, source string, start tailStart, out chan<- record) error {
+	records := o.newRecordScanner(r)
+	var last []record
+	for line := start.skipped + 1; records.Scan(); line++ {
+		text, end := records.Record()
+		rec := record{text: text, end: end, source: source, line: line, offset: start.offset + records.Offset()}
+		if o.stampRecords() {
+			rec.read = time.Now()
+		}
+		if start.keepLast == 0 {
+			out <- rec
+			continue
+		}
+		if len(last) == start.keepLast {
+			last = last[1:]
+		}
+		last = append(last, rec)
+	}
+	for _, rec := range last {
+		out <- rec
+	}
+	if o.merging() {
+		out <- record{source: source, eof: true}
+	}
+	return records.Err()
+}
+
+// countBefore counts the records before offset in f.
+func countBefore(f *os.File, offset int64, sep byte) (int, error) {
+	buf := make([]byte, 64<<10)
+	count := 0
+	for pos := int64(0); pos < offset; {
+		n, err := f.ReadAt(buf[:min(int64(len(buf)), offset-pos)], pos)
+		count += bytes.Count(buf[:n], []byte{sep})
+		pos += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// seekTail positions f at the start of its last n records, scanning backwards
+// from the end for the record separator.
+func seekTail(f *os.File, n int, sep byte) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	const chunk = 64 << 10
+	buf := make([]byte, chunk)
+	pos := size
+	found := 0
+	for pos > 0 {
+		readSize := int64(chunk)
+		if pos < readSize {
+			readSize = pos
+		}
+		pos -= readSize
+		if _, err := f.ReadAt(buf[:readSize], pos); err != nil {
+			return err
+		}
+		for i := int(readSize) - 1; i >= 0; i-- {
+			if buf[i] != sep {
+				continue
+			}
+			// A separator ending the file doesn't start a record
+			if pos+int64(i) == size-1 {
+				continue
+			}
+			if found++; found == n {
+				_, err := f.Seek(pos+int64(i)+1, io.SeekStart)
+				return err
+			}
+		}
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// followPoll is how often a followed file is checked for new data.
+const followPoll = 250 * time.Millisecond
+
+// followReader reads a file like tail -F: at the end it waits for more data
+// instead of returning io.EOF. If the file is truncated it starts over, and
+// if it is replaced, as by log rotation, it reopens the path.
+type followReader struct {
+	path string
+	f    *os.File
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		if n > 0 || (err != nil && !errors.Is(err, io.EOF)) {
+			return n, err
+		}
+		time.Sleep(followPoll)
+		r.checkRotation()
+	}
+}
+
+// checkRotation reopens the path if the file was replaced, and rewinds it if
+// it was truncated.
+func (r *followReader) checkRotation() {
+	current, err := r.f.Stat()
+	if err != nil {
+		return
+	}
+	if latest, err := os.Stat(r.path); err == nil && !os.SameFile(current, latest) {
+		if f, err := os.Open(r.path); err == nil {
+			r.f.Close()
+			r.f = f
+		}
+		return
+	}
+	if pos, err := r.f.Seek(0, io.SeekCurrent); err == nil && current.Size() < pos {
+		r.f.Seek(0, io.SeekStart)
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
+
+// recordSep returns the record separator as it appears in the raw input, or
+// nil for a /regex/ --delimiter, which can't be searched for backwards.
+func (o *options) recordSep() []byte {
+	sep := "\n"
+	switch {
+	case o.nullData:
+		sep = "\x00"
+	case o.delimiterRe != nil:
+		return nil
+	case o.delimiter != "":
+		sep = o.delimiter
+	}
+	if o.inputEncoding != nil {
+		encoded, err := o.inputEncoding.NewEncoder().String(sep)
+		if err != nil {
+			return nil
+		}
+		sep = encoded
+	}
+	return []byte(sep)
+}
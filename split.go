@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// splitDelay is how long a line waits for a line from the other pane to
+// share its row before it is shown on its own.
+const splitDelay = 100 * time.Millisecond
+
+// splitSeparator divides the panes.
+const splitSeparator = " │ "
+
+// splitPane is one side of the split view: its input and rules.
+type splitPane struct {
+	m       *matcher
+	records <-chan record
+	errc    <-chan error
+	pending [][]string // rows of the records not shown yet
+}
+
+// splitMatchers builds the matchers of the left and right panes: the shared
+// rules with the pane's own from --left or --right. The rules are colored
+// together, so a shared rule has the same color in both panes.
+func (o *options) splitMatchers(shared []string) ([2]*matcher, error) {
+	var matchers [2]*matcher
+	all, err := o.newMatcher(slices.Concat(shared, o.splitLeft, o.splitRight), nil)
+	if err != nil {
+		return matchers, err
+	}
+	pattern := func(rule string) string {
+		return splitRule(normalizeRule(rule, o.sep), ruleSep)[0]
+	}
+	for i, own := range [2][]string{o.splitLeft, o.splitRight} {
+		// Leave out the rules only the other pane has
+		others := make(map[string]bool)
+		for _, rule := range [2][]string{o.splitRight, o.splitLeft}[i] {
+			others[pattern(rule)] = true
+		}
+		for _, rule := range slices.Concat(shared, own) {
+			delete(others, pattern(rule))
+		}
+		m := &matcher{opts: all.opts}
+		for _, cfg := range all.configs {
+			if !others[cfg.original] {
+				m.configs = append(m.configs, cfg)
+			}
+		}
+		matchers[i] = m
+	}
+	return matchers, nil
+}
+
+// splitRows renders a record as the rows it takes in a pane width columns wide.
+// Long lines are wrapped, or cut with --truncate.
+func (o *options) splitRows(m *matcher, rec record, width int) []string {
+	text := o.prepare(rec.text)
+	line := m.opts.render(text, m.find(text))
+	if o.truncate.set {
+		return []string{truncateANSI(line, width)}
+	}
+	return wrapANSI(line, width)
+}
+
+// runSplit implements `ch split`: it reads the files at the two paths at the
+// same time and shows them side by side, each pane highlighted with its own
+// matcher. With -f the files are followed, so two live logs can be watched
+// together.
+func runSplit(w io.Writer, o *options, paths [2]string, matchers [2]*matcher) error {
+	width := o.wrap.width()
+	if o.truncate.set {
+		width = o.truncate.width()
+	}
+	paneWidth := max((width-displayWidth(splitSeparator))/2, 1)
+	separator := dimColor + splitSeparator + Reset
+
+	var panes [2]*splitPane
+	for i, path := range paths {
+		input := *o
+		input.files = []string{path}
+		input.readFiles = true
+		records, errc := input.startInputs()
+		panes[i] = &splitPane{m: matchers[i], records: records, errc: errc}
+	}
+
+	fmt.Fprintln(w, padRight(truncateANSI(paths[0], paneWidth), paneWidth)+separator+truncateANSI(paths[1], paneWidth))
+	fmt.Fprintln(w, dimColor+strings.Repeat("─", paneWidth)+"─┼─"+strings.Repeat("─", paneWidth)+Reset)
+
+	// show writes the next record of each pane side by side, on as many rows
+	// as the longer one takes
+	show := func() {
+		var rows [2][]string
+		for i, p := range panes {
+			if len(p.pending) > 0 {
+				rows[i], p.pending = p.pending[0], p.pending[1:]
+			}
+		}
+		for i := range max(len(rows[0]), len(rows[1])) {
+			var left, right string
+			if i < len(rows[0]) {
+				left = rows[0][i]
+			}
+			if i < len(rows[1]) {
+				right = rows[1][i]
+			}
+			fmt.Fprintln(w, padRight(left, paneWidth)+separator+right)
+		}
+	}
+	pending := func() bool { return len(panes[0].pending) > 0 || len(panes[1].pending) > 0 }
+
+	var firstErr error
+	open := len(panes)
+	receive := func(p *splitPane, rec record, ok bool) {
+		if !ok {
+			// Stop selecting on the closed channel
+			p.records = nil
+			open--
+			if err := <-p.errc; err != nil && firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		if !rec.eof {
+			p.pending = append(p.pending, o.splitRows(p.m, rec, paneWidth))
+		}
+	}
+
+	var timeout <-chan time.Time
+	for {
+		for len(panes[0].pending) > 0 && len(panes[1].pending) > 0 {
+			show()
+		}
+		if open == 0 {
+			for pending() {
+				show()
+			}
+			return firstErr
+		}
+		switch {
+		case !pending():
+			timeout = nil
+		case timeout == nil:
+			timeout = time.After(splitDelay)
+		}
+
+		select {
+		case rec, ok := <-panes[0].records:
+			receive(panes[0], rec, ok)
+		case rec, ok := <-panes[1].records:
+			receive(panes[1], rec, ok)
+		case <-timeout:
+			// The other pane is quiet; show the lines on their own
+			timeout = nil
+			for pending() {
+				show()
+			}
+		}
+	}
+}
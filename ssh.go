@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// sshHosts returns the hosts given to --ssh, which may be comma-separated
+// and repeated.
+func (o *options) sshHosts() []string {
+	var hosts []string
+	for _, list := range o.ssh {
+		for _, host := range strings.Split(list, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// readSSH runs the --cmd command on every --ssh host and sends its output as
+// records tagged with the host. ssh runs in batch mode, since prompts from
+// several hosts at once can't be answered; hosts need key-based login.
+func (o *options) readSSH(out chan<- record) error {
+	return followAll(o.sshHosts(), func(host string) error {
+		return o.readCommand(exec.Command("ssh", "-T", "-o", "BatchMode=yes", host, o.sshCommand), host, out)
+	})
+}
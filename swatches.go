@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// swatchColumns is how many named colors are printed per row.
+const swatchColumns = 2
+
+// swatch renders a color sample followed by its name and hex value.
+func swatch(name string, r, g, b int) string {
+	return fmt.Sprintf("%s      %s %s%-20s%s #%02X%02X%02X",
+		rgbToANSI(r, g, b, true), Reset, rgbToANSI(r, g, b, false), name, Reset, r, g, b)
+}
+
+// printSwatches prints colors as swatches, swatchColumns per row.
+func printSwatches(w io.Writer, colors []namedColor) {
+	for i, nc := range colors {
+		fmt.Fprint(w, "  ", swatch(nc.name, nc.r, nc.g, nc.b))
+		if (i+1)%swatchColumns == 0 || i == len(colors)-1 {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// runColors implements `ch colors`: it prints the active palette, all named
+// colors and samples of the other color syntaxes so users can pick colors
+// without trial and error.
+func runColors(w io.Writer, paletteName string) {
+	if paletteName == "" {
+		paletteName = "default"
+	}
+	fmt.Fprintf(w, "Palette (%s), in assignment order:\n", paletteName)
+	printSwatches(w, palette)
+
+	fmt.Fprintln(w, "\nGenerated colors, used after the palette runs out:")
+	var generated []namedColor
+	for i := 0; i < 6; i++ {
+		r, g, b := generatedColor(i)
+		generated = append(generated, namedColor{name: fmt.Sprintf("auto #%d", len(palette)+i+1), r: r, g: g, b: b})
+	}
+	printSwatches(w, generated)
+
+	fmt.Fprintln(w, "\nPreset named colors:")
+	printSwatches(w, namedColors)
+
+	fmt.Fprintln(w, "\nCSS color names:")
+	printSwatches(w, cssColors)
+
+	fmt.Fprintln(w, "\nOther syntaxes:")
+	var samples []namedColor
+	for _, spec := range []string{"FF5500", "#f50", "rgb(255,80,0)", "hsl(20,100%,50%)"} {
+		r, g, b, _ := parseRGB(spec)
+		samples = append(samples, namedColor{name: spec, r: r, g: g, b: b})
+	}
+	printSwatches(w, samples)
+
+	fmt.Fprintln(w, "\nEffects:")
+	sample := strings.Repeat("█", 24)
+	for _, spec := range []string{"rainbow-chars", "red..0000FF"} {
+		effect := parseColorEffect(spec, false)
+		fmt.Fprintf(w, "  %s %s\n", effect.paint(sample), spec)
+	}
+	rainbow := parseColorEffect("rainbow", false)
+	fmt.Fprint(w, "  ")
+	for i := 0; i < 8; i++ {
+		fmt.Fprint(w, rainbow.paint("███"))
+	}
+	fmt.Fprintln(w, " rainbow (per match)")
+}
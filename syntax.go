@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// syntaxColors are the colors of the syntax coloring of structured text, by
+// token kind. They're resolved from the named colors, so themes apply.
+type syntaxColors struct {
+	key     string // object keys, YAML keys and XML tag names
+	attr    string // XML attribute names
+	str     string
+	number  string
+	literal string // true, false, null and the like
+	comment string
+	punct   string
+}
+
+// loadSyntaxColors resolves the syntax colors from the current named colors.
+func loadSyntaxColors() syntaxColors {
+	color := func(name string) string {
+		c, _ := parseColor(name, false)
+		return c
+	}
+	return syntaxColors{
+		key:     color("blue"),
+		attr:    color("pink"),
+		str:     color("green"),
+		number:  color("orange"),
+		literal: color("purple"),
+		comment: dimColor,
+		punct:   dimColor,
+	}
+}
+
+// syntaxLanguages color the content of a line for --syntax, returning the
+// colored spans in order.
+var syntaxLanguages = map[string]func(line string, colors syntaxColors) []span{
+	"yaml": yamlSyntax,
+	"xml":  xmlSyntax,
+	"sql":  sqlSyntax,
+}
+
+// syntaxNames lists the --syntax languages ch has its own coloring for,
+// besides those of the code highlighter.
+func syntaxNames() []string {
+	names := []string{"code"}
+	for name := range syntaxLanguages {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookupSyntax resolves a --syntax language: ch's own yaml, xml and sql,
+// code to color the code in diffs and compiler errors, or any language the
+// code highlighter knows, such as go, python or rust.
+func lookupSyntax(name string) (func(string, syntaxColors) []span, error) {
+	lower := strings.ToLower(name)
+	if lower == "yml" {
+		lower = "yaml"
+	}
+	if lang, ok := syntaxLanguages[lower]; ok {
+		return lang, nil
+	}
+	if lower == "code" {
+		return newCodeSyntax(), nil
+	}
+	if lang := lexerSyntax(lower); lang != nil {
+		return lang, nil
+	}
+	return nil, fmt.Errorf("unknown --syntax language '%s' (use %s, or a language like go or python)", name, strings.Join(syntaxNames(), ", "))
+}
+
+var (
+	yamlKey     = regexp.MustCompile(`^("(?:[^"\\]|\\.)*"|'[^']*'|[^\s#'"\[\]{},][^#]*?)\s*:(?:\s|$)`)
+	yamlNumber  = regexp.MustCompile(`^[-+]?(?:\d[\d_]*(?:\.\d*)?(?:[eE][-+]?\d+)?|\.\d+|0x[0-9a-fA-F]+|\.inf|\.nan)$`)
+	yamlLiteral = regexp.MustCompile(`^(?:true|false|null|yes|no|on|off|~|True|False|Null|TRUE|FALSE|NULL)$`)
+)
+
+// yamlSyntax colors a line of YAML: comments, document markers, list dashes,
+// keys, and scalar values by their type. Each line is colored on its own, so
+// block scalars are colored like plain values.
+func yamlSyntax(line string, colors syntaxColors) (spans []span) {
+	add := func(start, end int, color string) {
+		if start < end {
+			spans = append(spans, span{start: start, end: end, color: color})
+		}
+	}
+
+	// A comment starts with a # at the start or after a space, outside quotes
+	end := len(line)
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			end = i
+		}
+		if end < len(line) {
+			break
+		}
+	}
+	defer add(end, len(line), colors.comment)
+
+	pos := len(line[:end]) - len(strings.TrimLeft(line[:end], " \t"))
+	if rest := strings.TrimSpace(line[pos:end]); rest == "---" || rest == "..." {
+		add(pos, pos+3, colors.punct)
+		return spans
+	}
+	for pos < end && line[pos] == '-' && (pos+1 == end || line[pos+1] == ' ') {
+		add(pos, pos+1, colors.punct)
+		pos += 1 + len(line[pos+1:end]) - len(strings.TrimLeft(line[pos+1:end], " "))
+	}
+	if m := yamlKey.FindStringSubmatchIndex(line[pos:end]); m != nil {
+		add(pos, pos+m[3], colors.key)
+		colon := pos + strings.IndexByte(line[pos+m[3]:end], ':') + m[3]
+		add(colon, colon+1, colors.punct)
+		pos = colon + 1
+	}
+
+	value := strings.TrimSpace(line[pos:end])
+	if value == "" {
+		return spans
+	}
+	start := pos + strings.Index(line[pos:end], value)
+	color := colors.str
+	switch {
+	case strings.ContainsAny(value[:1], "|>[{"):
+		// Block scalar indicators and flow collections stay plain
+		return spans
+	case strings.ContainsAny(value[:1], "&*!"):
+		color = colors.literal
+	case yamlNumber.MatchString(value):
+		color = colors.number
+	case yamlLiteral.MatchString(value):
+		color = colors.literal
+	}
+	add(start, start+len(value), color)
+	return spans
+}
+
+var (
+	xmlName      = regexp.MustCompile(`^[\w:.-]+`)
+	xmlAttribute = regexp.MustCompile(`^([\w:.-]+)(\s*=\s*)("[^"]*"|'[^']*')?`)
+	xmlEntity    = regexp.MustCompile(`^&(?:\w+|#\d+|#x[0-9a-fA-F]+);`)
+)
+
+// xmlSyntax colors a line of XML or HTML: comments, tag names, attributes and
+// their values, and entities. Each line is colored on its own, so tags and
+// comments that span lines are only colored on their first line.
+func xmlSyntax(line string, colors syntaxColors) []span {
+	var spans []span
+	add := func(start, end int, color string) {
+		if start < end {
+			spans = append(spans, span{start: start, end: end, color: color})
+		}
+	}
+	for i := 0; i < len(line); {
+		switch {
+		case strings.HasPrefix(line[i:], "<!--"):
+			end := strings.Index(line[i+4:], "-->")
+			if end < 0 {
+				end = len(line)
+			} else {
+				end += i + 7
+			}
+			add(i, end, colors.comment)
+			i = end
+		case line[i] == '<':
+			open := i + 1
+			if open < len(line) && strings.IndexByte("/?!", line[open]) >= 0 {
+				open++
+			}
+			name := xmlName.FindString(line[open:])
+			if name == "" {
+				i++
+				continue
+			}
+			add(i, open, colors.punct)
+			add(open, open+len(name), colors.key)
+			i = open + len(name)
+			// Attributes, up to the end of the tag
+			for i < len(line) && line[i] != '>' {
+				if m := xmlAttribute.FindStringSubmatchIndex(line[i:]); m != nil {
+					add(i+m[2], i+m[3], colors.attr)
+					if m[6] >= 0 {
+						add(i+m[6], i+m[7], colors.str)
+					}
+					i += m[1]
+					continue
+				}
+				if strings.IndexByte("/?", line[i]) >= 0 {
+					add(i, i+1, colors.punct)
+				}
+				i++
+			}
+			if i < len(line) {
+				add(i, i+1, colors.punct)
+				i++
+			}
+		case line[i] == '&':
+			if m := xmlEntity.FindString(line[i:]); m != "" {
+				add(i, i+len(m), colors.literal)
+				i += len(m)
+				continue
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// syntaxText returns line[start:end] outside highlights, colored by the
+// syntax spans that cover it, and tinted elsewhere.
+func (opts highlightOptions) syntaxText(line string, start, end int) string {
+	var b strings.Builder
+	write := func(from, to int, color string) {
+		if from >= to {
+			return
+		}
+		text := line[from:to]
+		if opts.showAll {
+			text = showNonPrinting(line, from, to, true)
+		}
+		if color == "" {
+			color = opts.tint
+		}
+		if color == "" {
+			b.WriteString(text)
+			return
+		}
+		b.WriteString(color + strings.ReplaceAll(text, Reset, Reset+color) + Reset)
+	}
+	pos := start
+	for _, s := range opts.syntax {
+		if s.end <= pos || s.start >= end {
+			continue
+		}
+		write(pos, max(s.start, pos), "")
+		pos = max(s.start, pos)
+		write(pos, min(s.end, end), s.color)
+		pos = min(s.end, end)
+	}
+	write(pos, end, "")
+	return b.String()
+}
+
+// sqlStart finds where an SQL statement begins in a log line.
+var sqlStart = regexp.MustCompile(`(?i)\b(?:SELECT|INSERT\s+INTO|UPDATE|DELETE\s+FROM|WITH|CREATE|ALTER|DROP|TRUNCATE|MERGE|UPSERT|REPLACE\s+INTO|BEGIN|COMMIT|ROLLBACK|EXPLAIN)\b`)
+
+// sqlToken matches the tokens of SQL, in the order of sqlSyntax's cases.
+var sqlToken = regexp.MustCompile(`^(?:(--[^\n]*|/\*.*?(?:\*/|$))|('(?:[^']|'')*'?)|("[^"]*"|` + "`[^`]*`" + `)|(\$\d+|\?|:[A-Za-z_]\w*|@[A-Za-z_]\w*)|(\d+(?:\.\d+)?(?:[eE][-+]?\d+)?\b)|([A-Za-z_]\w*))`)
+
+// sqlKeywords are the SQL keywords colored by sqlSyntax, in upper case.
+var sqlKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range strings.Fields(`
+		SELECT FROM WHERE AND OR NOT IN IS NULL LIKE ILIKE BETWEEN EXISTS AS ON
+		JOIN INNER LEFT RIGHT FULL OUTER CROSS NATURAL USING GROUP BY ORDER HAVING
+		LIMIT OFFSET FETCH FIRST NEXT ROWS ONLY UNION ALL INTERSECT EXCEPT DISTINCT
+		INSERT INTO VALUES UPDATE SET DELETE RETURNING WITH RECURSIVE CASE WHEN THEN
+		ELSE END ASC DESC NULLS CREATE ALTER DROP TABLE INDEX VIEW IF PRIMARY KEY
+		FOREIGN REFERENCES DEFAULT CONSTRAINT UNIQUE CHECK ADD COLUMN TRUNCATE
+		MERGE MATCHED UPSERT REPLACE CONFLICT DO NOTHING BEGIN COMMIT ROLLBACK
+		TRANSACTION SAVEPOINT EXPLAIN ANALYZE FOR SHARE LOCK OVER PARTITION WINDOW
+		CAST TRUE FALSE COUNT SUM AVG MIN MAX COALESCE LATERAL`) {
+		sqlKeywords[kw] = true
+	}
+}
+
+// sqlSyntax colors the SQL statement in a line, from the first keyword that
+// starts one to the end of the line: keywords, strings, quoted identifiers,
+// numbers, bind parameters and comments.
+func sqlSyntax(line string, colors syntaxColors) []span {
+	loc := sqlStart.FindStringIndex(line)
+	if loc == nil {
+		return nil
+	}
+	var spans []span
+	for i := loc[0]; i < len(line); {
+		m := sqlToken.FindStringSubmatchIndex(line[i:])
+		if m == nil {
+			i++
+			continue
+		}
+		var color string
+		switch {
+		case m[2] >= 0:
+			color = colors.comment
+		case m[4] >= 0:
+			color = colors.str
+		case m[6] >= 0:
+			color = colors.attr
+		case m[8] >= 0:
+			color = colors.literal
+		case m[10] >= 0:
+			color = colors.number
+		case sqlKeywords[strings.ToUpper(line[i:i+m[1]])]:
+			color = colors.key
+		}
+		if color != "" {
+			spans = append(spans, span{start: i, end: i + m[1], color: color})
+		}
+		i += m[1]
+	}
+	return spans
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseListen splits a --listen address like udp://:5514 into its network and
+// host:port.
+func parseListen(addr string) (network, hostport string, err error) {
+	network, hostport, found := strings.Cut(addr, "://")
+	if !found || (network != "udp" && network != "tcp") {
+		return "", "", fmt.Errorf("--listen needs udp://HOST:PORT or tcp://HOST:PORT, not '%s'", addr)
+	}
+	return network, hostport, nil
+}
+
+// maxSyslogMessage is the largest message read, the most a UDP datagram holds.
+const maxSyslogMessage = 64 << 10
+
+// serveSyslog listens on the --listen address and sends each syslog message
+// received as a record. It only returns if listening fails.
+func (o *options) serveSyslog(out chan<- record) error {
+	network, hostport, err := parseListen(o.listen)
+	if err != nil {
+		return err
+	}
+	if network == "udp" {
+		conn, err := net.ListenPacket(network, hostport)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		fmt.Fprintf(os.Stderr, "ch: listening for syslog on udp %s\n", conn.LocalAddr())
+		buf := make([]byte, maxSyslogMessage)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return err
+			}
+			out <- record{text: parseSyslog(string(buf[:n])), end: "\n"}
+		}
+	}
+
+	ln, err := net.Listen(network, hostport)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	fmt.Fprintf(os.Stderr, "ch: listening for syslog on tcp %s\n", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				msg, err := readSyslogFrame(r)
+				if msg != "" {
+					out <- record{text: parseSyslog(msg), end: "\n"}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// readSyslogFrame reads one message from a syslog TCP stream. Messages are
+// either prefixed with their length in octets or end in a newline (RFC 6587).
+func readSyslogFrame(r *bufio.Reader) (string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		count, err := r.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(count, " "))
+		if err != nil || n > maxSyslogMessage {
+			return "", fmt.Errorf("bad syslog frame length '%s'", count)
+		}
+		msg := make([]byte, n)
+		_, err = io.ReadFull(r, msg)
+		return string(msg), err
+	}
+	msg, err := r.ReadString('\n')
+	return msg, err
+}
+
+// syslogSeverities are the names of the severity levels, indexed by value.
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// parseSyslog turns an RFC 5424 or RFC 3164 message into a readable line:
+// timestamp, host, severity name and the rest. Severity names like err or
+// warning are then easy to highlight. Anything else is returned as it is.
+func parseSyslog(msg string) string {
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	end := strings.IndexByte(msg, '>')
+	if !strings.HasPrefix(msg, "<") || end < 2 || end > 4 {
+		return msg
+	}
+	pri, err := strconv.Atoi(msg[1:end])
+	if err != nil || pri > 191 {
+		return msg
+	}
+	severity := syslogSeverities[pri%8]
+	msg = msg[end+1:]
+
+	// RFC 5424: VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	if strings.HasPrefix(msg, "1 ") {
+		fields := strings.SplitN(msg[2:], " ", 6)
+		if len(fields) == 6 {
+			value := func(s string) string {
+				if s == "-" {
+					return ""
+				}
+				return s
+			}
+			timestamp, host, app, pid, msgID := value(fields[0]), value(fields[1]), value(fields[2]), value(fields[3]), value(fields[4])
+			sd, text := splitStructuredData(fields[5])
+			tag := app
+			if pid != "" {
+				tag += "[" + pid + "]"
+			}
+			parts := []string{timestamp, host, severity}
+			for _, p := range []string{tag + ":", msgID, sd, strings.TrimPrefix(text, bom)} {
+				if p != "" && p != ":" {
+					parts = append(parts, p)
+				}
+			}
+			return strings.Join(parts, " ")
+		}
+	}
+
+	// RFC 3164: Mmm dd hh:mm:ss HOSTNAME TAG: MSG
+	if len(msg) > len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, msg[:len(time.Stamp)]); err == nil {
+			timestamp, rest := msg[:len(time.Stamp)], strings.TrimPrefix(msg[len(time.Stamp):], " ")
+			host, rest, _ := strings.Cut(rest, " ")
+			return timestamp + " " + host + " " + severity + " " + rest
+		}
+	}
+	return severity + " " + msg
+}
+
+// splitStructuredData splits the RFC 5424 structured data off the front of
+// s, returning "" for the nil value -.
+func splitStructuredData(s string) (sd, rest string) {
+	if strings.HasPrefix(s, "- ") || s == "-" {
+		return "", strings.TrimPrefix(s[1:], " ")
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		// Skip to the closing bracket, past escaped ones
+		for i++; i < len(s) && s[i] != ']'; i++ {
+			if s[i] == '\\' {
+				i++
+			}
+		}
+		i++
+	}
+	i = min(i, len(s))
+	return s[:i], strings.TrimPrefix(s[i:], " ")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// parseTemplate compiles the --template and the --fields regex that splits
+// lines into the fields it and --cut refer to.
+func (o *options) parseTemplate() error {
+	o.tmpl, o.fieldsRe = nil, nil
+	if o.fields != "" {
+		if o.template == "" && o.cut == "" {
+			return fmt.Errorf("--fields needs --template or --cut")
+		}
+		if !isRegexRule(o.fields) || !strings.HasSuffix(o.fields, "/") {
+			return fmt.Errorf("invalid --fields '%s' (want a /regex/ with named groups)", o.fields)
+		}
+		re, err := regexp.Compile(o.fields[1 : len(o.fields)-1])
+		if err != nil {
+			return fmt.Errorf("invalid --fields regex '%s': %v", o.fields, err)
+		}
+		o.fieldsRe = re
+	}
+	if o.template == "" {
+		return nil
+	}
+	tmpl, err := template.New("template").Option("missingkey=zero").Parse(o.template)
+	if err != nil {
+		return fmt.Errorf("invalid --template: %v", err)
+	}
+	o.tmpl = tmpl
+	return nil
+}
+
+// reshape rewrites line with the --template, filled in with its fields, or
+// returns it as it is if it has none or the template fails on it.
+func (o *options) reshape(line string) string {
+	if o.tmpl == nil {
+		return line
+	}
+	fields := o.parseFields(line)
+	if len(fields) == 0 {
+		return line
+	}
+	var b bytes.Buffer
+	if err := o.tmpl.Execute(&b, fields); err != nil {
+		return line
+	}
+	return b.String()
+}
+
+// parseFields splits line into named fields: with the groups of the --fields
+// regex, or else as a JSON object or as logfmt key=value pairs. Nested JSON
+// objects are flattened to dotted keys, as in http.status, and also kept
+// whole under their own key as JSON.
+func (o *options) parseFields(line string) map[string]string {
+	if o.fieldsRe != nil {
+		m := o.fieldsRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil
+		}
+		fields := make(map[string]string)
+		for i, name := range o.fieldsRe.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			fields[name] = m[i]
+		}
+		return fields
+	}
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "{") {
+		dec := json.NewDecoder(strings.NewReader(trimmed))
+		dec.UseNumber()
+		var object map[string]any
+		if dec.Decode(&object) == nil {
+			fields := make(map[string]string)
+			flattenFields(fields, "", object)
+			return fields
+		}
+	}
+	return parseLogfmt(line)
+}
+
+// flattenFields adds the values of object to fields, their keys prefixed.
+func flattenFields(fields map[string]string, prefix string, object map[string]any) {
+	for key, value := range object {
+		switch v := value.(type) {
+		case string:
+			fields[prefix+key] = v
+		case nil:
+			fields[prefix+key] = ""
+		default:
+			if nested, ok := v.(map[string]any); ok {
+				flattenFields(fields, prefix+key+".", nested)
+			}
+			data, _ := json.Marshal(v)
+			fields[prefix+key] = string(data)
+		}
+	}
+}
+
+// parseLogfmt splits a logfmt line, as in level=info msg="user logged in",
+// into its key=value pairs. Quoted values are unquoted, and words without a
+// value are left out.
+func parseLogfmt(line string) map[string]string {
+	var fields map[string]string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		if i == start {
+			// A stray =
+			i++
+			continue
+		}
+		if i == len(line) || line[i] != '=' {
+			continue
+		}
+		key := line[start:i]
+		i++
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			quoted := line[i:end]
+			if unquoted, err := strconv.Unquote(quoted); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(quoted, `"`)
+			}
+			i = end
+		} else {
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			value = line[start:i]
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[key] = value
+	}
+	return fields
+}
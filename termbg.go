@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// backgroundQueryTimeout bounds how long we wait for the terminal to answer
+// the OSC 11 query. Terminals that don't support it never reply.
+const backgroundQueryTimeout = 150 * time.Millisecond
+
+// detectTheme picks the light or dark theme from the terminal background
+// color, falling back to dark when it cannot be determined.
+func detectTheme() string {
+	if r, g, b, ok := queryBackground(); ok {
+		if luminance(r, g, b) > 0.5 {
+			return "light"
+		}
+		return "dark"
+	}
+
+	// COLORFGBG is "fg;bg" with ANSI color indexes, set by rxvt, Konsole and others
+	if fgbg := os.Getenv("COLORFGBG"); fgbg != "" {
+		parts := strings.Split(fgbg, ";")
+		if bg, err := strconv.Atoi(parts[len(parts)-1]); err == nil && (bg == 7 || bg == 15) {
+			return "light"
+		}
+	}
+	return "dark"
+}
+
+// queryBackground asks the terminal for its background color with OSC 11.
+func queryBackground() (r, g, b int, ok bool) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return 0, 0, 0, false
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	defer tty.Close()
+
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	defer term.Restore(int(tty.Fd()), state)
+
+	if _, err := tty.WriteString("\033]11;?\033\\"); err != nil {
+		return 0, 0, 0, false
+	}
+	if err := tty.SetReadDeadline(time.Now().Add(backgroundQueryTimeout)); err != nil {
+		return 0, 0, 0, false
+	}
+
+	// The reply is ESC ] 11 ; rgb:RRRR/GGGG/BBBB terminated by BEL or ESC \
+	var reply []byte
+	buf := make([]byte, 64)
+	for {
+		n, err := tty.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil || strings.HasSuffix(string(reply), "\a") || strings.HasSuffix(string(reply), "\033\\") {
+			break
+		}
+	}
+	return parseOSCColor(string(reply))
+}
+
+// parseOSCColor extracts the color from an OSC 10/11 reply.
+func parseOSCColor(reply string) (r, g, b int, ok bool) {
+	idx := strings.Index(reply, "rgb:")
+	if idx == -1 {
+		return 0, 0, 0, false
+	}
+	spec := strings.TrimRight(reply[idx+4:], "\a\033\\")
+	parts := strings.Split(spec, "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+
+	var rgb [3]int
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 16, 16)
+		if err != nil || len(p) == 0 || len(p) > 4 {
+			return 0, 0, 0, false
+		}
+		// Scale 1-4 hex digits to 8 bits
+		max := uint64(1)<<(4*len(p)) - 1
+		rgb[i] = int(v * 255 / max)
+	}
+	return rgb[0], rgb[1], rgb[2], true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// theme remaps the named colors and the default auto-assignment palette,
+// e.g. for light or dark terminal backgrounds. User themes are read from
+// $XDG_CONFIG_HOME/ch/themes/<name>.yaml.
+type theme struct {
+	// Colors overrides named colors, mapping a name to a hex or named color
+	Colors map[string]string `yaml:"colors"`
+	// Palette is the default auto-assignment order, by color name or hex
+	Palette []string `yaml:"palette"`
+	// Lightness of rainbow and generated colors, between 0 and 1
+	Lightness float64 `yaml:"lightness"`
+}
+
+// Built-in themes. The dark theme keeps the pastel presets; the light theme
+// uses deeper shades that stay legible on white backgrounds.
+var themes = map[string]*theme{
+	"dark": {},
+	"light": {
+		Colors: map[string]string{
+			"red":    "C0392B",
+			"green":  "2E7D32",
+			"orange": "D35400",
+			"blue":   "1F618D",
+			"pink":   "C2185B",
+			"purple": "6C3483",
+		},
+		Lightness: 0.4,
+	},
+}
+
+// loadTheme finds a theme by name, preferring user theme files over the
+// built-in themes.
+func loadTheme(name string) (*theme, error) {
+	if dir := configDir(); dir != "" {
+		path := filepath.Join(dir, "themes", name+".yaml")
+		data, err := os.ReadFile(path)
+		if err == nil {
+			t := &theme{}
+			if err := yaml.Unmarshal(data, t); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			return t, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if t, ok := themes[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown theme '%s'", name)
+}
+
+// apply remaps namedColors and the default palette according to the theme.
+func (t *theme) apply() error {
+	remapped := make([]namedColor, len(namedColors))
+	copy(remapped, namedColors)
+	for name, value := range t.Colors {
+		r, g, b, err := parseRGB(value)
+		if err != nil {
+			return fmt.Errorf("theme: invalid color '%s' for '%s': %v", value, name, err)
+		}
+		found := false
+		for i := range remapped {
+			if strings.EqualFold(remapped[i].name, name) {
+				remapped[i].r, remapped[i].g, remapped[i].b = r, g, b
+				found = true
+			}
+		}
+		if !found {
+			remapped = append(remapped, namedColor{name: strings.ToLower(name), r: r, g: g, b: b})
+		}
+	}
+	namedColors = remapped
+
+	defaultPalette := namedColors
+	if len(t.Palette) > 0 {
+		defaultPalette = nil
+		for _, value := range t.Palette {
+			r, g, b, err := parseRGB(value)
+			if err != nil {
+				return fmt.Errorf("theme: invalid palette color '%s': %v", value, err)
+			}
+			defaultPalette = append(defaultPalette, namedColor{name: strings.ToLower(value), r: r, g: g, b: b})
+		}
+	}
+	palettes["default"] = defaultPalette
+	palette = defaultPalette
+
+	if t.Lightness > 0 {
+		rainbowLightness = t.Lightness
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timestampFormat is a timestamp layout found in logs, with a regexp that
+// finds it in a line.
+type timestampFormat struct {
+	re     *regexp.Regexp
+	layout string
+	// yearless layouts, like syslog's, take the current year
+	yearless bool
+}
+
+// timestampFormats are tried in order; the first found in a line is used.
+var timestampFormats = []timestampFormat{
+	// ISO 8601 and RFC 3339, with a T or a space, as in 2024-05-01T12:00:00.123Z
+	{re: regexp.MustCompile(`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:[.,]\d+)?(?:Z|[+-]\d\d:?\d\d)?`), layout: "iso"},
+	// Common Log Format, as in [01/May/2024:12:00:00 +0000]
+	{re: regexp.MustCompile(`\d\d/[A-Z][a-z]{2}/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}`), layout: "02/Jan/2006:15:04:05 -0700"},
+	// syslog, as in May  1 12:00:00
+	{re: regexp.MustCompile(`\b[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d(?:\.\d+)?`), layout: "Jan _2 15:04:05", yearless: true},
+}
+
+// parseTimestamp finds the first timestamp in line. Timestamps without a time
+// zone are taken as local time.
+func parseTimestamp(line string) (time.Time, bool) {
+	for _, f := range timestampFormats {
+		s := f.re.FindString(line)
+		if s == "" {
+			continue
+		}
+		if f.layout == "iso" {
+			if t, ok := parseISOTimestamp(s); ok {
+				return t, true
+			}
+			continue
+		}
+		layout := f.layout
+		if i := strings.IndexByte(s, '.'); i >= 0 && f.yearless {
+			layout += "." + strings.Repeat("0", len(s)-i-1)
+		}
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if f.yearless {
+			t = t.AddDate(time.Now().Year(), 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseISOTimestamp parses the variants of ISO 8601 matched by the first
+// timestampFormat.
+func parseISOTimestamp(s string) (time.Time, bool) {
+	s = strings.Replace(s, " ", "T", 1)
+	s = strings.Replace(s, ",", ".", 1)
+	// Zone offsets may lack the colon RFC 3339 wants, as in +0200
+	if n := len(s); n > 5 && (s[n-5] == '+' || s[n-5] == '-') && !strings.Contains(s[n-5:], ":") {
+		s = s[:n-2] + ":" + s[n-2:]
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05.999999999", s, time.Local)
+	return t, err == nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTSFormat is the --ts format when none is given, the same as ts
+// from moreutils.
+const defaultTSFormat = "%b %d %H:%M:%S"
+
+// tsFlag is a flag that takes an optional strftime format, as in --ts or
+// --ts='%H:%M:%.S'.
+type tsFlag struct {
+	set    bool
+	format string
+}
+
+func (f *tsFlag) String() string { return f.format }
+
+func (f *tsFlag) Set(value string) error {
+	f.set, f.format = value != "false", defaultTSFormat
+	if value == "true" || value == "false" {
+		return nil
+	}
+	if _, err := strftime(time.Time{}, value); err != nil {
+		return err
+	}
+	f.format = value
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a format.
+func (f *tsFlag) IsBoolFlag() bool { return true }
+
+// strftime formats t with a strftime format. As with ts, %.S, %.s and %.T
+// add microseconds to the seconds.
+func strftime(t time.Time, format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		if i++; i == len(format) {
+			return "", fmt.Errorf("format ends with a lone %%")
+		}
+		fraction := format[i] == '.'
+		if fraction {
+			if i++; i == len(format) || !strings.ContainsRune("STs", rune(format[i])) {
+				return "", fmt.Errorf("%%. must be followed by S, T or s")
+			}
+		}
+		switch format[i] {
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'e':
+			b.WriteString(t.Format("_2"))
+		case 'j':
+			b.WriteString(t.Format("002"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'I':
+			b.WriteString(t.Format("03"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'b', 'h':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'Z':
+			b.WriteString(t.Format("MST"))
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'F':
+			b.WriteString(t.Format("2006-01-02"))
+		case 'D':
+			b.WriteString(t.Format("01/02/06"))
+		case 'T':
+			b.WriteString(t.Format("15:04:05"))
+		case 'R':
+			b.WriteString(t.Format("15:04"))
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unknown format directive %%%c", format[i])
+		}
+		if fraction {
+			fmt.Fprintf(&b, ".%06d", t.Nanosecond()/1000)
+		}
+	}
+	return b.String(), nil
+}
+
+// stampRecords reports whether records need the time they were read.
+func (o *options) stampRecords() bool {
+	return o.ts.set || o.elapsedSince.set
+}
+
+// timestamp returns the --ts prefix of a record read at t.
+func (o *options) timestamp(t time.Time) string {
+	s, _ := strftime(t, o.ts.format)
+	return dimColor + s + Reset + " "
+}
+
+// elapsedFlag is a flag that takes an optional reference point, as in
+// --elapsed or --elapsed=previous: time since ch started, or since the line
+// before.
+type elapsedFlag struct {
+	set      bool
+	previous bool
+}
+
+func (f *elapsedFlag) String() string {
+	if f.previous {
+		return "previous"
+	}
+	return ""
+}
+
+func (f *elapsedFlag) Set(value string) error {
+	switch value {
+	case "true", "start":
+		f.set, f.previous = true, false
+	case "previous":
+		f.set, f.previous = true, true
+	case "false":
+		f.set, f.previous = false, false
+	default:
+		return fmt.Errorf("want start or previous")
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f *elapsedFlag) IsBoolFlag() bool { return true }
+
+// elapsed returns the --elapsed prefix of a record: the time since ch
+// started, or since the record before with --elapsed=previous. Records from
+// session files count from the start of the recording.
+func (o *options) elapsed(rec record) string {
+	var d time.Duration
+	switch {
+	case o.elapsedSince.previous:
+		if !o.lastRead.IsZero() {
+			d = rec.read.Sub(o.lastRead)
+		}
+		o.lastRead = rec.read
+		return dimColor + "+" + formatElapsed(d) + Reset + " "
+	case rec.timed:
+		d = rec.at
+	default:
+		d = rec.read.Sub(o.started)
+	}
+	return dimColor + formatElapsed(d) + Reset + " "
+}
+
+// formatElapsed formats a duration as minutes, seconds and milliseconds, as
+// in 01:02.345, with the hours in front past an hour.
+func formatElapsed(d time.Duration) string {
+	d = max(d, 0)
+	ms := d.Milliseconds()
+	s := fmt.Sprintf("%02d:%02d.%03d", ms/60000%60, ms/1000%60, ms%1000)
+	if d >= time.Hour {
+		s = fmt.Sprintf("%d:%s", ms/3600000, s)
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+// Package version reports build metadata for ch, so bug reports and tools
+// embedding ch can identify the exact build.
+//
+// Release builds set the variables with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/sharunkumar/ch/version.Version=v1.2.3 \
+//	    -X github.com/sharunkumar/ch/version.Commit=$(git rev-parse HEAD) \
+//	    -X github.com/sharunkumar/ch/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without ldflags fall back to the module and VCS information recorded
+// by the Go toolchain.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with -ldflags -X.
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// Info is the build metadata of the running binary.
+type Info struct {
+	Version   string
+	Commit    string
+	Date      string
+	GoVersion string
+	Platform  string
+}
+
+// Get returns the build metadata, preferring values set with -ldflags over
+// those embedded by the Go toolchain.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		modified := false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && Commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// String formats the metadata for --version output.
+func (i Info) String() string {
+	s := "ch " + i.Version
+	if i.Commit != "" {
+		s += fmt.Sprintf("\ncommit: %s", i.Commit)
+	}
+	if i.Date != "" {
+		s += fmt.Sprintf("\nbuilt:  %s", i.Date)
+	}
+	return s + fmt.Sprintf("\ngo:     %s %s", i.GoVersion, i.Platform)
+}
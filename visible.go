@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// showNonPrinting renders line[start:end] with invisible characters drawn as
+// symbols, in the spirit of cat -A: tabs as →, trailing spaces as ·, carriage
+// returns as ␍, no-break spaces as ⍽, control characters in caret notation
+// (^[ for ESC) and other format characters such as zero-width spaces as
+// <U+200B>. Symbols are dimmed when dim is set.
+func showNonPrinting(line string, start, end int, dim bool) string {
+	trailing := len(strings.TrimRight(line, " \t\r"))
+	var b strings.Builder
+	for i := start; i < end; {
+		r, size := utf8.DecodeRuneInString(line[i:end])
+		symbol := ""
+		switch {
+		case r == '\t':
+			symbol = "→"
+		case r == ' ' && i >= trailing:
+			symbol = "·"
+		case r == '\r':
+			symbol = "␍"
+		case r == '\u00a0':
+			symbol = "⍽"
+		case r < 0x20:
+			symbol = "^" + string(rune(r+'@'))
+		case r == 0x7f:
+			symbol = "^?"
+		case r != utf8.RuneError && (unicode.IsControl(r) || unicode.Is(unicode.Cf, r)):
+			symbol = fmt.Sprintf("<U+%04X>", r)
+		}
+
+		switch {
+		case symbol == "":
+			b.WriteString(line[i : i+size])
+		case dim:
+			b.WriteString(dimColor + symbol + Reset)
+		default:
+			b.WriteString(symbol)
+		}
+		i += size
+	}
+	return b.String()
+}
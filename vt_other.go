@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// virtualTerminalStatus reports whether the console processes ANSI escape
+// sequences. Only Windows consoles need it enabled explicitly.
+func virtualTerminalStatus() string {
+	return "n/a (not Windows)"
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// virtualTerminalStatus reports whether the console processes ANSI escape
+// sequences, which ch needs for colors.
+func virtualTerminalStatus() string {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(os.Stdout.Fd()), &mode); err != nil {
+		return "n/a (stdout is not a console)"
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return "enabled"
+	}
+	return "disabled (colors will show as raw escape codes)"
+}
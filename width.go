@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// ansiEscape matches CSI escape sequences such as colors, which take no room
+// on screen.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]`)
+
+// displayWidth returns the number of terminal columns s occupies. East Asian
+// wide characters and most emoji take two columns, combining marks none, and
+// escape sequences are ignored.
+func displayWidth(s string) int {
+	if strings.Contains(s, "\x1b") {
+		s = ansiEscape.ReplaceAllString(s, "")
+	}
+	return uniseg.StringWidth(s)
+}
+
+// padRight pads s with spaces to width columns. Unlike fmt's %-*s it counts
+// columns rather than runes, so tables with wide characters line up.
+func padRight(s string, width int) string {
+	if n := displayWidth(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of tabWidth
+// columns, counting wide characters as two columns.
+func expandTabs(line string, tabWidth int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	state := -1
+	for line != "" {
+		var cluster string
+		var width int
+		cluster, line, width, state = uniseg.FirstGraphemeClusterInString(line, state)
+		switch cluster {
+		case "\t":
+			n := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case "\n":
+			b.WriteString(cluster)
+			col = 0
+		default:
+			b.WriteString(cluster)
+			col += width
+		}
+	}
+	return b.String()
+}